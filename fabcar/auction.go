@@ -0,0 +1,637 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Auctions and the public part of sealed bids are stored under composite keys
+// in world state, the bid plaintext under bidPrivateObjectType in the private
+// data collection of the bidder organisation
+const (
+	auctionObjectType      = "auction~carNumber"
+	bidObjectType          = "bid~carNumber~auctionID~bidID"
+	bidPrivateObjectType   = "bid~auctionID~bidID"
+	bidTransientKey        = "bid"
+	auctionStatusOpen      = "Open"
+	auctionStatusClosed    = "Closed"
+	auctionStatusCancelled = "Cancelled"
+)
+
+// Auction describes a sealed-bid auction of a car. Bids are made in Currency
+// until EndTime, revealed afterwards and the seller then closes the auction. An
+// auction is Cancelled when the car is reported stolen or scrapped meanwhile
+type Auction struct {
+	AuctionID     string `json:"auctionID"`
+	CarNumber     string `json:"carNumber"`
+	SellerMSP     string `json:"sellerMSP"`
+	SellerID      string `json:"sellerID"`
+	Currency      string `json:"currency"`
+	EndTime       string `json:"endTime"`
+	AuctionStatus string `json:"auctionStatus"`
+	WinningBidID  string `json:"winningBidID,omitempty"`
+	WinningAmount *Money `json:"winningAmount,omitempty"`
+}
+
+// SealedBid is the public record of a bid. Only the hash of the bid is known
+// until the bidder reveals it
+type SealedBid struct {
+	BidID     string `json:"bidID"`
+	AuctionID string `json:"auctionID"`
+	CarNumber string `json:"carNumber"`
+	Bidder    string `json:"bidder"`
+	BidderMSP string `json:"bidderMSP"`
+	BidderID  string `json:"bidderID"`
+	BidHash   string `json:"bidHash"`
+	Revealed  bool   `json:"revealed"`
+	Amount    *Money `json:"amount,omitempty"`
+}
+
+// BidDetails is the plaintext of a bid passed in the transient map under the
+// bid key. The amount must be in the currency of the auction and the salt
+// keeps it from being guessed from the hash
+type BidDetails struct {
+	Amount Money  `json:"amount"`
+	Salt   string `json:"salt"`
+}
+
+// OpenAuction puts the car with given id up for auction in the ISO 4217
+// currency until endTime, given in RFC 3339 format, and marks it ForSale. Only
+// the owner may open an auction and the auction id, the transaction id, is
+// returned
+func (s *SmartContract) OpenAuction(ctx contractapi.TransactionContextInterface, carNumber string, endTime string, currency string) (string, error) {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return "", err
+	}
+
+	end, err := time.Parse(time.RFC3339, endTime)
+
+	if err != nil {
+		return "", fmt.Errorf("End time must be in RFC 3339 format. %s", err.Error())
+	}
+
+	if err := validateMoney("auction", Money{Currency: currency}); err != nil {
+		return "", err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !end.After(now) {
+		return "", fmt.Errorf("End time %s is not in the future", endTime)
+	}
+
+	before := *car
+
+	if err := transitionCarStatus(carNumber, car, StatusForSale); err != nil {
+		return "", err
+	}
+
+	auction := Auction{
+		AuctionID:     ctx.GetStub().GetTxID(),
+		CarNumber:     carNumber,
+		SellerMSP:     car.OwnerMSP,
+		SellerID:      car.OwnerID,
+		Currency:      currency,
+		EndTime:       end.UTC().Format(time.RFC3339),
+		AuctionStatus: auctionStatusOpen,
+	}
+
+	if err := putCarObject(ctx, car.OwnerMSP, auctionObjectType, []string{carNumber}, auction); err != nil {
+		return "", err
+	}
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return "", err
+	}
+
+	if err := emitCarEvent(ctx, statusChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car}); err != nil {
+		return "", err
+	}
+
+	return auction.AuctionID, nil
+}
+
+// QueryAuction returns the latest auction of the car with given id
+func (s *SmartContract) QueryAuction(ctx contractapi.TransactionContextInterface, carNumber string) (*Auction, error) {
+	auction := new(Auction)
+
+	found, err := getCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s has no auction", carNumber)
+	}
+
+	return auction, nil
+}
+
+// CreateBid seals a bid on the open auction of the car with given id. The
+// BidDetails are passed in the transient map under the bid key and stored in
+// the private data collection of the bidder organisation only. The collection
+// endorsement policy of collections_config.json lets a peer of that
+// organisation alone endorse the transaction, so no other organisation sees
+// the amount. The bid id, the transaction id, is returned and
+// must be published with SubmitBid
+func (s *SmartContract) CreateBid(ctx contractapi.TransactionContextInterface, carNumber string) (string, error) {
+	auction, err := s.QueryAuction(ctx, carNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := assertAuctionAcceptsBids(ctx, auction); err != nil {
+		return "", err
+	}
+
+	bidderMSP, bidderID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if bidderMSP == auction.SellerMSP && bidderID == auction.SellerID {
+		return "", fmt.Errorf("Seller cannot bid on %s", carNumber)
+	}
+
+	if err := assertPeerOrgMatchesClientOrg(bidderMSP); err != nil {
+		return "", err
+	}
+
+	bidAsBytes, _, err := getTransientBid(ctx, auction)
+
+	if err != nil {
+		return "", err
+	}
+
+	bidID := ctx.GetStub().GetTxID()
+	privateKey, err := ctx.GetStub().CreateCompositeKey(bidPrivateObjectType, []string{auction.AuctionID, bidID})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	if err := ctx.GetStub().PutPrivateData(orgCollectionName(bidderMSP), privateKey, bidAsBytes); err != nil {
+		return "", fmt.Errorf("Failed to put bid to private data. %s", err.Error())
+	}
+
+	return bidID, nil
+}
+
+// SubmitBid publishes a bid created with CreateBid on the open auction of the
+// car with given id. Only the hash of the private bid details is recorded
+func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, carNumber string, bidID string, bidder string) error {
+	auction, err := s.QueryAuction(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertAuctionAcceptsBids(ctx, auction); err != nil {
+		return err
+	}
+
+	bidderMSP, bidderID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if bidderMSP == auction.SellerMSP && bidderID == auction.SellerID {
+		return fmt.Errorf("Seller cannot bid on %s", carNumber)
+	}
+
+	existing := new(SealedBid)
+
+	found, err := getCompositeObject(ctx, bidObjectType, []string{carNumber, auction.AuctionID, bidID}, existing)
+
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return fmt.Errorf("Bid %s is already submitted", bidID)
+	}
+
+	privateKey, err := ctx.GetStub().CreateCompositeKey(bidPrivateObjectType, []string{auction.AuctionID, bidID})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	bidHash, err := ctx.GetStub().GetPrivateDataHash(orgCollectionName(bidderMSP), privateKey)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read bid hash from private data. %s", err.Error())
+	}
+
+	if bidHash == nil {
+		return fmt.Errorf("Bid %s does not exist in the private data of %s", bidID, bidderMSP)
+	}
+
+	bid := SealedBid{
+		BidID:     bidID,
+		AuctionID: auction.AuctionID,
+		CarNumber: carNumber,
+		Bidder:    bidder,
+		BidderMSP: bidderMSP,
+		BidderID:  bidderID,
+		BidHash:   hex.EncodeToString(bidHash),
+	}
+
+	return putCarObject(ctx, auction.SellerMSP, bidObjectType, []string{carNumber, auction.AuctionID, bidID}, bid)
+}
+
+// RevealBid discloses a submitted bid once bidding on the auction of the car
+// with given id has ended. The same BidDetails bytes passed to CreateBid are
+// passed in the transient map again and must match the recorded hash. Only the
+// bidder may reveal a bid
+func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, carNumber string, bidID string) error {
+	auction, err := s.QueryAuction(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if auction.AuctionStatus != auctionStatusOpen {
+		return fmt.Errorf("Auction of %s is %s", carNumber, auction.AuctionStatus)
+	}
+
+	ended, err := auctionEnded(ctx, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if !ended {
+		return fmt.Errorf("Bidding on %s ends at %s, bids cannot be revealed before", carNumber, auction.EndTime)
+	}
+
+	bid := new(SealedBid)
+
+	found, err := getCompositeObject(ctx, bidObjectType, []string{carNumber, auction.AuctionID, bidID}, bid)
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("Bid %s on %s does not exist", bidID, carNumber)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if mspID != bid.BidderMSP || clientID != bid.BidderID {
+		return fmt.Errorf("Only the bidder may reveal bid %s", bidID)
+	}
+
+	if bid.Revealed {
+		return fmt.Errorf("Bid %s is already revealed", bidID)
+	}
+
+	bidAsBytes, details, err := getTransientBid(ctx, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if hashPrivateData(bidAsBytes) != bid.BidHash {
+		return fmt.Errorf("Bid details do not match the hash of bid %s", bidID)
+	}
+
+	bid.Revealed = true
+	bid.Amount = &details.Amount
+
+	return putCompositeObject(ctx, bidObjectType, []string{carNumber, auction.AuctionID, bidID}, bid)
+}
+
+// QueryBids returns the public records of all bids on the latest auction of the car with given id
+func (s *SmartContract) QueryBids(ctx contractapi.TransactionContextInterface, carNumber string) ([]SealedBid, error) {
+	auction, err := s.QueryAuction(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getAuctionBids(ctx, auction)
+}
+
+// CloseAuction ends the auction of the car with given id after its end time.
+// The car is sold to the highest revealed bid, the first in bid id order on a
+// tie, and its price set to the bid amount. Without revealed bids the car is
+// Registered again. Only the seller may close the auction
+func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	auction, err := s.QueryAuction(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if auction.AuctionStatus != auctionStatusOpen {
+		return fmt.Errorf("Auction of %s is %s", carNumber, auction.AuctionStatus)
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return err
+	}
+
+	if car.OwnerMSP != auction.SellerMSP || car.OwnerID != auction.SellerID {
+		return fmt.Errorf("%s changed owner since the auction was opened", carNumber)
+	}
+
+	ended, err := auctionEnded(ctx, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if !ended {
+		return fmt.Errorf("Bidding on %s ends at %s", carNumber, auction.EndTime)
+	}
+
+	bids, err := getAuctionBids(ctx, auction)
+
+	if err != nil {
+		return err
+	}
+
+	var winner *SealedBid
+
+	for i := range bids {
+		if bids[i].Revealed && (winner == nil || bids[i].Amount.Amount > winner.Amount.Amount) {
+			winner = &bids[i]
+		}
+	}
+
+	auction.AuctionStatus = auctionStatusClosed
+	before := *car
+
+	if winner == nil {
+		if err := transitionCarStatus(carNumber, car, StatusRegistered); err != nil {
+			return err
+		}
+
+		if err := putCar(ctx, carNumber, car); err != nil {
+			return err
+		}
+
+		if err := putCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction); err != nil {
+			return err
+		}
+
+		return emitCarEvent(ctx, statusChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+	}
+
+	auction.WinningBidID = winner.BidID
+	auction.WinningAmount = winner.Amount
+
+	if err := transitionCarStatus(carNumber, car, StatusSold); err != nil {
+		return err
+	}
+
+	car.Price = *winner.Amount
+
+	if err := transferCar(ctx, carNumber, car, winner.Bidder, winner.BidderMSP, winner.BidderID); err != nil {
+		return err
+	}
+
+	if err := recordPriceChange(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := putCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, carSoldEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// assertNoOpenAuction returns an error if the car is being auctioned
+func assertNoOpenAuction(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	auction := new(Auction)
+
+	found, err := getCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if found && auction.AuctionStatus == auctionStatusOpen {
+		return fmt.Errorf("%s is being auctioned", carNumber)
+	}
+
+	return nil
+}
+
+// cancelOpenAuction cancels the auction of the car if it is still open, so no
+// more bids are taken and it can no longer be closed
+func cancelOpenAuction(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	auction := new(Auction)
+
+	found, err := getCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if !found || auction.AuctionStatus != auctionStatusOpen {
+		return nil
+	}
+
+	auction.AuctionStatus = auctionStatusCancelled
+
+	return putCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction)
+}
+
+// setAuctionEndorsementPolicy gives the auction record of the car, if there is
+// one, the endorsement policy of the new owner organisation, which reuses the
+// record for its own auctions
+func setAuctionEndorsementPolicy(ctx contractapi.TransactionContextInterface, carNumber string, ownerMSP string) error {
+	auction := new(Auction)
+
+	found, err := getCompositeObject(ctx, auctionObjectType, []string{carNumber}, auction)
+
+	if err != nil || !found {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(auctionObjectType, []string{carNumber})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	return setCarObjectEndorsementPolicy(ctx, carNumber, key, ownerMSP)
+}
+
+// assertAuctionAcceptsBids returns an error unless the auction is open and its end time has not passed
+func assertAuctionAcceptsBids(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+	if auction.AuctionStatus != auctionStatusOpen {
+		return fmt.Errorf("Auction of %s is %s", auction.CarNumber, auction.AuctionStatus)
+	}
+
+	ended, err := auctionEnded(ctx, auction)
+
+	if err != nil {
+		return err
+	}
+
+	if ended {
+		return fmt.Errorf("Bidding on %s ended at %s", auction.CarNumber, auction.EndTime)
+	}
+
+	return nil
+}
+
+// auctionEnded reports whether the transaction timestamp is at or after the end time of the auction
+func auctionEnded(ctx contractapi.TransactionContextInterface, auction *Auction) (bool, error) {
+	end, err := time.Parse(time.RFC3339, auction.EndTime)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read auction end time. %s", err.Error())
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !now.Before(end), nil
+}
+
+// getAuctionBids returns the public records of every bid on the auction in key order
+func getAuctionBids(ctx contractapi.TransactionContextInterface, auction *Auction) ([]SealedBid, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bidObjectType, []string{auction.CarNumber, auction.AuctionID})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	bids := []SealedBid{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		bid := SealedBid{}
+
+		if err := json.Unmarshal(queryResponse.Value, &bid); err != nil {
+			return nil, fmt.Errorf("Failed to decode bid. %s", err.Error())
+		}
+
+		bids = append(bids, bid)
+	}
+
+	return bids, nil
+}
+
+// getTransientBid returns the raw and decoded BidDetails passed in the transient
+// map for a bid on the auction
+func getTransientBid(ctx contractapi.TransactionContextInterface, auction *Auction) ([]byte, *BidDetails, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read transient map. %s", err.Error())
+	}
+
+	bidAsBytes, ok := transientMap[bidTransientKey]
+
+	if !ok {
+		return nil, nil, fmt.Errorf("Bid details must be passed in the transient map under %q", bidTransientKey)
+	}
+
+	details := new(BidDetails)
+
+	if err := json.Unmarshal(bidAsBytes, details); err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode bid details. %s", err.Error())
+	}
+
+	if details.Amount.Currency != auction.Currency {
+		return nil, nil, fmt.Errorf("Bids on %s must be made in %s", auction.CarNumber, auction.Currency)
+	}
+
+	if details.Amount.Amount <= 0 {
+		return nil, nil, fmt.Errorf("Bid amount must be greater than zero")
+	}
+
+	if strings.TrimSpace(details.Salt) == "" {
+		return nil, nil, fmt.Errorf("Bid salt must not be empty")
+	}
+
+	return bidAsBytes, details, nil
+}
+
+// hashPrivateData returns the hex encoded SHA-256 hash of private data such as
+// bid details, matching the private data hash Fabric records for it
+func hashPrivateData(valueAsBytes []byte) string {
+	hash := sha256.Sum256(valueAsBytes)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// orgCollectionName returns the name of the private data collection of a
+// single organisation. Unlike the implicit collection of the organisation it
+// is defined in collections_config.json with an endorsement policy satisfied
+// by a peer of that organisation alone
+func orgCollectionName(mspID string) string {
+	return "private" + mspID
+}
+
+// assertPeerOrgMatchesClientOrg returns an error unless the endorsing peer
+// belongs to the client organisation, which is required to write to the
+// private data collection of that organisation
+func assertPeerOrgMatchesClientOrg(clientMSP string) error {
+	peerMSP, err := shim.GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read peer MSP ID. %s", err.Error())
+	}
+
+	if peerMSP != clientMSP {
+		return fmt.Errorf("Client from %s cannot be endorsed by a peer of %s", clientMSP, peerMSP)
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// openAuction opens an auction of the car in USD ending an hour from now and returns its id
+func (f *fabcarTest) openAuction(owner *testClient, carNumber string) string {
+	f.t.Helper()
+
+	var auctionID string
+	endTime := f.clock.Add(time.Hour).Format(time.RFC3339)
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) (err error) {
+		auctionID, err = f.contract.OpenAuction(ctx, carNumber, endTime, "USD")
+		return err
+	}))
+
+	return auctionID
+}
+
+// bidDetails returns the BidDetails of a bid in USD as passed in the transient map
+func bidDetails(t *testing.T, amount int64, salt string) map[string][]byte {
+	t.Helper()
+
+	bidAsBytes, err := json.Marshal(BidDetails{Amount: Money{Amount: amount, Currency: "USD"}, Salt: salt})
+
+	if err != nil {
+		t.Fatalf("failed to encode bid: %v", err)
+	}
+
+	return map[string][]byte{bidTransientKey: bidAsBytes}
+}
+
+// placeBid creates and submits a sealed bid of the bidder and returns its id.
+// The endorsing peer is set to the bidder organisation
+func (f *fabcarTest) placeBid(bidder *testClient, carNumber string, amount int64, salt string) string {
+	f.t.Helper()
+
+	var bidID string
+
+	f.setPeerMSP(bidder.MSPID)
+	assertNoError(f.t, f.withTransient(bidDetails(f.t, amount, salt)).submit(bidder, func(ctx contractapi.TransactionContextInterface) (err error) {
+		bidID, err = f.contract.CreateBid(ctx, carNumber)
+		return err
+	}))
+	assertNoError(f.t, f.submit(bidder, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SubmitBid(ctx, carNumber, bidID, "Bidder")
+	}))
+
+	return bidID
+}
+
+// revealBid reveals the bid of the bidder
+func (f *fabcarTest) revealBid(bidder *testClient, carNumber string, bidID string, amount int64, salt string) error {
+	f.t.Helper()
+
+	return f.withTransient(bidDetails(f.t, amount, salt)).submit(bidder, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.RevealBid(ctx, carNumber, bidID)
+	})
+}
+
+// queryBids returns the public records of the bids on the car
+func (f *fabcarTest) queryBids(carNumber string) []SealedBid {
+	f.t.Helper()
+
+	var bids []SealedBid
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		bids, err = f.contract.QueryBids(ctx, carNumber)
+		return err
+	}))
+
+	return bids
+}
+
+func TestOpenAuction(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenAuction(ctx, "CAR10", "tomorrow", "USD")
+		return err
+	})
+	assertErrorContains(t, err, "End time must be in RFC 3339 format")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenAuction(ctx, "CAR10", "2020-12-31T00:00:00Z", "USD")
+		return err
+	})
+	assertErrorContains(t, err, "End time 2020-12-31T00:00:00Z is not in the future")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenAuction(ctx, "CAR10", "2021-02-01T00:00:00Z", "USD")
+		return err
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenAuction(ctx, "CAR10", "2021-02-01T00:00:00Z", "XXX")
+		return err
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+
+	auctionID := f.openAuction(f.alice, "CAR10")
+	assertEqual(t, f.queryCar("CAR10").Status, StatusForSale)
+
+	var auction *Auction
+
+	assertNoError(t, f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		auction, err = f.contract.QueryAuction(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, *auction, Auction{
+		AuctionID:     auctionID,
+		CarNumber:     "CAR10",
+		SellerMSP:     f.alice.MSPID,
+		SellerID:      f.alice.ID,
+		Currency:      "USD",
+		EndTime:       "2021-01-01T01:00:05Z",
+		AuctionStatus: auctionStatusOpen,
+	})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", 90000, "USD")
+	})
+	assertErrorContains(t, err, "CAR10 is being auctioned")
+}
+
+func TestCreateBidKeepsAmountPrivate(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	auctionID := f.openAuction(f.alice, "CAR10")
+
+	f.setPeerMSP(f.alice.MSPID)
+	err := f.withTransient(bidDetails(t, 90000, "pepper")).submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "Client from Org2MSP cannot be endorsed by a peer of Org1MSP")
+
+	f.setPeerMSP(f.bob.MSPID)
+	err = f.withTransient(bidDetails(t, 90000, " ")).submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "Bid salt must not be empty")
+
+	euroBid, err := json.Marshal(BidDetails{Amount: Money{Amount: 90000, Currency: "EUR"}, Salt: "pepper"})
+	assertNoError(t, err)
+	err = f.withTransient(map[string][]byte{bidTransientKey: euroBid}).submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "Bids on CAR10 must be made in USD")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, `Bid details must be passed in the transient map under "bid"`)
+
+	bidID := f.placeBid(f.bob, "CAR10", 90000, "pepper")
+
+	privateKey, err := f.stub.CreateCompositeKey(bidPrivateObjectType, []string{auctionID, bidID})
+	assertNoError(t, err)
+	bidAsBytes := bidDetails(t, 90000, "pepper")[bidTransientKey]
+	assertEqual(t, f.stub.PvtState[orgCollectionName(f.bob.MSPID)][privateKey], bidAsBytes)
+
+	assertEqual(t, f.queryBids("CAR10"), []SealedBid{{
+		BidID:     bidID,
+		AuctionID: auctionID,
+		CarNumber: "CAR10",
+		Bidder:    "Bidder",
+		BidderMSP: f.bob.MSPID,
+		BidderID:  f.bob.ID,
+		BidHash:   hashPrivateData(bidAsBytes),
+	}})
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SubmitBid(ctx, "CAR10", bidID, "Bidder")
+	})
+	assertErrorContains(t, err, "Bid "+bidID+" is already submitted")
+
+	err = f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SubmitBid(ctx, "CAR10", "tx9999", "Bank")
+	})
+	assertErrorContains(t, err, "Bid tx9999 does not exist in the private data of Org2MSP")
+}
+
+func TestSellerCannotBid(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	f.setPeerMSP(f.alice.MSPID)
+
+	err := f.withTransient(bidDetails(t, 90000, "pepper")).submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "Seller cannot bid on CAR10")
+}
+
+func TestRevealBid(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	bidID := f.placeBid(f.bob, "CAR10", 90000, "pepper")
+
+	err := f.revealBid(f.bob, "CAR10", bidID, 90000, "pepper")
+	assertErrorContains(t, err, "bids cannot be revealed before")
+
+	f.advance(time.Hour)
+
+	err = f.withTransient(bidDetails(t, 90000, "pepper")).submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SubmitBid(ctx, "CAR10", bidID, "Bidder")
+	})
+	assertErrorContains(t, err, "Bidding on CAR10 ended at")
+
+	err = f.revealBid(f.bank, "CAR10", bidID, 90000, "pepper")
+	assertErrorContains(t, err, "Only the bidder may reveal bid "+bidID)
+
+	err = f.revealBid(f.bob, "CAR10", bidID, 95000, "pepper")
+	assertErrorContains(t, err, "Bid details do not match the hash of bid "+bidID)
+
+	assertNoError(t, f.revealBid(f.bob, "CAR10", bidID, 90000, "pepper"))
+
+	bids := f.queryBids("CAR10")
+	assertEqual(t, bids[0].Revealed, true)
+	assertEqual(t, *bids[0].Amount, Money{Amount: 90000, Currency: "USD"})
+
+	err = f.revealBid(f.bob, "CAR10", bidID, 90000, "pepper")
+	assertErrorContains(t, err, "Bid "+bidID+" is already revealed")
+}
+
+func TestCloseAuction(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	low := f.placeBid(f.bob, "CAR10", 90000, "pepper")
+	first := f.placeBid(f.bank, "CAR10", 95000, "salt")
+	second := f.placeBid(f.bob, "CAR10", 95000, "cumin")
+	f.placeBid(f.bank, "CAR10", 99000, "unrevealed")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Bidding on CAR10 ends at")
+
+	f.advance(time.Hour)
+	assertNoError(t, f.revealBid(f.bob, "CAR10", low, 90000, "pepper"))
+	assertNoError(t, f.revealBid(f.bank, "CAR10", first, 95000, "salt"))
+	assertNoError(t, f.revealBid(f.bob, "CAR10", second, 95000, "cumin"))
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Status, StatusSold)
+	assertEqual(t, car.OwnerID, f.bank.ID)
+	assertEqual(t, car.Price, Money{Amount: 95000, Currency: "USD"})
+	assertEqual(t, f.lastCarEvent().Type, carSoldEvent)
+
+	var auction *Auction
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		auction, err = f.contract.QueryAuction(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, auction.AuctionStatus, auctionStatusClosed)
+	assertEqual(t, auction.WinningBidID, first)
+	assertEqual(t, *auction.WinningAmount, Money{Amount: 95000, Currency: "USD"})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Auction of CAR10 is Closed")
+}
+
+func TestCloseAuctionWithoutBids(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	f.advance(time.Hour)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Status, StatusRegistered)
+	assertEqual(t, car.OwnerID, f.alice.ID)
+	assertEqual(t, f.lastCarEvent().Type, statusChangedEvent)
+
+	f.listCar(f.alice, "CAR10", 90000)
+}
+
+func TestCloseAuctionOfStolenCar(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	f.placeBid(f.bob, "CAR10", 90000, "pepper")
+
+	assertNoError(t, f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR10")
+	}))
+
+	var auction *Auction
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		auction, err = f.contract.QueryAuction(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, auction.AuctionStatus, auctionStatusCancelled)
+
+	f.advance(time.Hour)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Auction of CAR10 is Cancelled")
+	assertEqual(t, f.queryCar("CAR10").Status, StatusStolen)
+
+	f.setPeerMSP(f.bank.MSPID)
+	err = f.withTransient(bidDetails(t, 95000, "salt")).submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateBid(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "Auction of CAR10 is Cancelled")
+}
+
+func TestChangeCarOwnerDuringAuction(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "CAR10 is being auctioned")
+	assertEqual(t, f.queryCar("CAR10").OwnerID, f.alice.ID)
+
+	f.advance(time.Hour)
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	}))
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+	f.listCar(f.bob, "CAR10", 90000)
+}
@@ -0,0 +1,103 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// regulatorMSPID is the organisation that has to endorse changes to every car
+// besides the owner organisation. Set it to "" to require the owner organisation only
+const regulatorMSPID = "Org3MSP"
+
+// QueryCarEndorsingOrgs returns the organisations whose peers have to endorse
+// changes to the car with given id. It is empty for cars without an owner
+// identity, which fall back to the chaincode endorsement policy
+func (s *SmartContract) QueryCarEndorsingOrgs(ctx contractapi.TransactionContextInterface, carNumber string) ([]string, error) {
+	if _, err := s.QueryCar(ctx, carNumber); err != nil {
+		return nil, err
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(carNumber)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read endorsement policy of %s. %s", carNumber, err.Error())
+	}
+
+	orgs := []string{}
+
+	if len(policy) == 0 {
+		return orgs, nil
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(policy)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode endorsement policy of %s. %s", carNumber, err.Error())
+	}
+
+	orgs = append(orgs, endorsementPolicy.ListOrgs()...)
+	sort.Strings(orgs)
+
+	return orgs, nil
+}
+
+// setCarEndorsementPolicy sets a key-level endorsement policy on the car so
+// that the peers of the owner organisation, and of the regulator organisation
+// when configured, have to endorse any later change to it
+func setCarEndorsementPolicy(ctx contractapi.TransactionContextInterface, carNumber string, ownerMSP string) error {
+	return setKeyEndorsementPolicy(ctx, carNumber, carNumber, ownerMSP)
+}
+
+// setCarObjectEndorsementPolicy gives the key of an object kept for the car,
+// such as a lien, sale listing or index entry, the endorsement policy of the
+// car owned by ownerMSP. Any two organisations satisfy the chaincode
+// endorsement policy when the key is created, but only the owner and regulator
+// organisations together may change it afterwards. Keys of cars without an
+// owner identity keep the chaincode endorsement policy like the car
+func setCarObjectEndorsementPolicy(ctx contractapi.TransactionContextInterface, carNumber string, key string, ownerMSP string) error {
+	if ownerMSP == "" {
+		return nil
+	}
+
+	return setKeyEndorsementPolicy(ctx, carNumber, key, ownerMSP)
+}
+
+// setKeyEndorsementPolicy requires the peers of the owner organisation, and of
+// the regulator organisation when configured, to endorse changes to key, which
+// is the car with given id or one of its objects
+func setKeyEndorsementPolicy(ctx contractapi.TransactionContextInterface, carNumber string, key string, ownerMSP string) error {
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+
+	if err != nil {
+		return err
+	}
+
+	orgs := []string{ownerMSP}
+
+	if regulatorMSPID != "" && regulatorMSPID != ownerMSP {
+		orgs = append(orgs, regulatorMSPID)
+	}
+
+	if err := endorsementPolicy.AddOrgs(statebased.RoleTypePeer, orgs...); err != nil {
+		return fmt.Errorf("Failed to add orgs to endorsement policy of %s. %s", carNumber, err.Error())
+	}
+
+	policy, err := endorsementPolicy.Policy()
+
+	if err != nil {
+		return fmt.Errorf("Failed to create endorsement policy of %s. %s", carNumber, err.Error())
+	}
+
+	if err := ctx.GetStub().SetStateValidationParameter(key, policy); err != nil {
+		return fmt.Errorf("Failed to set endorsement policy of %s. %s", carNumber, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// queryEndorsingOrgs returns the organisations that have to endorse changes to the car
+func (f *fabcarTest) queryEndorsingOrgs(carNumber string) []string {
+	f.t.Helper()
+
+	var orgs []string
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		orgs, err = f.contract.QueryCarEndorsingOrgs(ctx, carNumber)
+		return err
+	}))
+
+	return orgs
+}
+
+// objectEndorsingOrgs returns the organisations that have to endorse changes to
+// each committed key of objectType starting with attributes, in key order
+func (f *fabcarTest) objectEndorsingOrgs(objectType string, attributes ...string) [][]string {
+	f.t.Helper()
+
+	resultsIterator, err := f.stub.MockStub.GetStateByPartialCompositeKey(objectType, attributes)
+	assertNoError(f.t, err)
+	defer resultsIterator.Close()
+
+	keyOrgs := [][]string{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		assertNoError(f.t, err)
+
+		policy, err := f.stub.MockStub.GetStateValidationParameter(queryResponse.Key)
+		assertNoError(f.t, err)
+
+		orgs := []string{}
+
+		if len(policy) > 0 {
+			endorsementPolicy, err := statebased.NewStateEP(policy)
+			assertNoError(f.t, err)
+
+			orgs = append(orgs, endorsementPolicy.ListOrgs()...)
+			sort.Strings(orgs)
+		}
+
+		keyOrgs = append(keyOrgs, orgs)
+	}
+
+	return keyOrgs
+}
+
+func TestQueryCarEndorsingOrgs(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+
+	assertEqual(t, f.queryEndorsingOrgs("CAR0"), []string{})
+	assertEqual(t, f.queryEndorsingOrgs("CAR10"), []string{"Org1MSP", regulatorMSPID})
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+	assertEqual(t, f.queryEndorsingOrgs("CAR10"), []string{"Org2MSP", regulatorMSPID})
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CreateCar(ctx, "CAR11", testVIN(11), "Ford", "Focus", "red", "Police", 1, "EUR")
+	}))
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR11", "Police", f.police.MSPID, f.police.ID)
+	}))
+	assertEqual(t, f.queryEndorsingOrgs("CAR11"), []string{regulatorMSPID})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCarEndorsingOrgs(ctx, "CAR404")
+		return err
+	})
+	assertErrorContains(t, err, "CAR404 does not exist")
+}
+
+func TestCarObjectEndorsingOrgs(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	vin := f.createCar(f.alice, "CAR10")
+	seller := []string{"Org1MSP", regulatorMSPID}
+	buyer := []string{"Org2MSP", regulatorMSPID}
+
+	// objects of cars without an owner identity keep the chaincode endorsement policy
+	assertEqual(t, f.objectEndorsingOrgs(priceChangeObjectType, "CAR0"), [][]string{{}})
+
+	lienID := f.registerLien(f.bank, "CAR10", 50000)
+	_, err := f.addServiceRecord(f.bob, "CAR10", "2020-06-01", 15000)
+	assertNoError(t, err)
+	f.openNegotiation(f.alice, "CAR10")
+
+	assertEqual(t, f.objectEndorsingOrgs(ownerIndexName, "Alice", "CAR10"), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(vinIndexName, vin), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(lienObjectType, "CAR10"), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(lienLenderIndexName, f.bank.MSPID, f.bank.ID), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(serviceRecordObjectType, "CAR10"), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(negotiationObjectType, "CAR10"), [][]string{seller})
+
+	assertNoError(t, f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", lienID)
+	}))
+
+	f.listCar(f.alice, "CAR10", 100000)
+	offerID := f.makeOffer(f.bob, "CAR10", 100000)
+
+	assertEqual(t, f.objectEndorsingOrgs(saleListingObjectType, "CAR10"), [][]string{seller})
+	assertEqual(t, f.objectEndorsingOrgs(saleOfferObjectType, "CAR10"), [][]string{seller})
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	}))
+
+	// the listing and offers are deleted together with their policies
+	assertEqual(t, f.objectEndorsingOrgs(saleListingObjectType, "CAR10"), [][]string{})
+	assertEqual(t, f.objectEndorsingOrgs(saleOfferObjectType, "CAR10"), [][]string{})
+	assertEqual(t, f.objectEndorsingOrgs(ownerIndexName, "Alice", "CAR10"), [][]string{})
+	assertEqual(t, f.objectEndorsingOrgs(ownerIndexName, "Bob", "CAR10"), [][]string{buyer})
+	assertEqual(t, f.objectEndorsingOrgs(priceChangeObjectType, "CAR10"), [][]string{seller, buyer})
+}
+
+func TestAuctionEndorsingOrgs(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.openAuction(f.alice, "CAR10")
+	bidID := f.placeBid(f.bob, "CAR10", 95000, "salt")
+
+	assertEqual(t, f.objectEndorsingOrgs(auctionObjectType, "CAR10"), [][]string{{"Org1MSP", regulatorMSPID}})
+	assertEqual(t, f.objectEndorsingOrgs(bidObjectType, "CAR10"), [][]string{{"Org1MSP", regulatorMSPID}})
+
+	f.advance(time.Hour)
+	assertNoError(t, f.revealBid(f.bob, "CAR10", bidID, 95000, "salt"))
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CloseAuction(ctx, "CAR10")
+	}))
+
+	// the winner reuses the auction record of the car for its own auctions
+	assertEqual(t, f.objectEndorsingOrgs(auctionObjectType, "CAR10"), [][]string{{"Org2MSP", regulatorMSPID}})
+	assertEqual(t, f.objectEndorsingOrgs(bidObjectType, "CAR10"), [][]string{{"Org1MSP", regulatorMSPID}})
+}
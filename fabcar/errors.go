@@ -0,0 +1,52 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ErrorCode tells apart the kinds of failure reported by a ContractError
+type ErrorCode string
+
+// Error codes returned to clients
+const (
+	CodeInvalidArgument ErrorCode = "InvalidArgument"
+	CodeAlreadyExists   ErrorCode = "AlreadyExists"
+)
+
+// ContractError is an error clients can tell apart by its code. Its message
+// reaches clients as JSON, e.g. {"code":"AlreadyExists","message":"CAR0 already exists"}.
+// Transactions working on a batch report the failed items in Items
+type ContractError struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Items   []ItemError `json:"items,omitempty"`
+}
+
+// ItemError reports why a single item of a batch was rejected
+type ItemError struct {
+	Index   int       `json:"index"`
+	Key     string    `json:"key,omitempty"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// Error returns the JSON encoding of the error
+func (e *ContractError) Error() string {
+	errorAsBytes, err := json.Marshal(e)
+
+	if err != nil {
+		return string(e.Code) + ": " + e.Message
+	}
+
+	return string(errorAsBytes)
+}
+
+// newContractError returns a ContractError with the given code and formatted message
+func newContractError(code ErrorCode, format string, args ...interface{}) *ContractError {
+	return &ContractError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,67 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// carEventVersion is the version of the CarEvent payload. It is increased
+// whenever the payload changes in a way listeners have to account for
+const carEventVersion = 2
+
+// Names of the chaincode events emitted when cars change
+const (
+	carCreatedEvent    = "CarCreated"
+	ownerChangedEvent  = "OwnerChanged"
+	ownerBoundEvent    = "OwnerBound"
+	priceChangedEvent  = "PriceChanged"
+	statusChangedEvent = "StatusChanged"
+	carSoldEvent       = "CarSold"
+	vinAssignedEvent   = "VINAssigned"
+)
+
+// CarChange describes a single car before and after a transaction. Before is
+// omitted for created cars
+type CarChange struct {
+	CarNumber string `json:"carNumber"`
+	Before    *Car   `json:"before,omitempty"`
+	After     *Car   `json:"after,omitempty"`
+}
+
+// CarEvent is the payload of every chaincode event emitted by the contract.
+// Fabric keeps one event per transaction, so a transaction touching several
+// cars reports them all as changes of a single event
+type CarEvent struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type"`
+	TxID    string      `json:"txId"`
+	Changes []CarChange `json:"changes"`
+}
+
+// emitCarEvent sets the chaincode event of the transaction to an event of the given type
+func emitCarEvent(ctx contractapi.TransactionContextInterface, eventType string, changes ...CarChange) error {
+	event := CarEvent{
+		Version: carEventVersion,
+		Type:    eventType,
+		TxID:    ctx.GetStub().GetTxID(),
+		Changes: changes,
+	}
+
+	eventAsBytes, err := json.Marshal(event)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s event. %s", eventType, err.Error())
+	}
+
+	if err := ctx.GetStub().SetEvent(eventType, eventAsBytes); err != nil {
+		return fmt.Errorf("Failed to set %s event. %s", eventType, err.Error())
+	}
+
+	return nil
+}
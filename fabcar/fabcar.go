@@ -7,23 +7,43 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+const (
+	// registryMSPID is the organisation whose admins may bind legacy cars to an owner identity
+	registryMSPID = "Org1MSP"
+	// authorityMSPID is the organisation that may report cars stolen or recovered
+	authorityMSPID = "Org3MSP"
+)
+
+// carNumberPattern is the format of the keys cars are stored under
+var carNumberPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 // SmartContract provides functions for managing a car
 type SmartContract struct {
 	contractapi.Contract
 }
 
-// Car describes basic details of what makes up a car
+// Car describes basic details of what makes up a car. SchemaVersion is the
+// layout the car was stored in, see schema.go
 type Car struct {
-	Make   string `json:"make"`
-	Model  string `json:"model"`
-	Colour string `json:"colour"`
-	Owner  string `json:"owner"`
-	Price  int    `json:"price"`
+	Make          string    `json:"make"`
+	Model         string    `json:"model"`
+	Colour        string    `json:"colour"`
+	Owner         string    `json:"owner"`
+	OwnerMSP      string    `json:"ownerMSP,omitempty"`
+	OwnerID       string    `json:"ownerID,omitempty"`
+	Price         Money     `json:"price"`
+	Status        CarStatus `json:"status,omitempty"`
+	VIN           string    `json:"vin,omitempty"`
+	SchemaVersion int       `json:"schemaVersion"`
 }
 
 // QueryResult structure used for handling result of query
@@ -32,46 +52,107 @@ type QueryResult struct {
 	Record *Car
 }
 
+// PaginatedQueryResult structure used for handling a page of query results
+type PaginatedQueryResult struct {
+	Records             []QueryResult `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// HistoryResult structure used for handling result of history query
+type HistoryResult struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Record    *Car   `json:"Record,omitempty"`
+}
+
 // InitLedger adds a base set of cars to the ledger
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	cars := []Car{
-		Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Price: 10000},
-		Car{Make: "Ford", Model: "Mustang", Colour: "red", Owner: "Brad", Price: 20000},
-		Car{Make: "Hyundai", Model: "Tucson", Colour: "green", Owner: "Jin Soo", Price: 8000},
-		Car{Make: "Volkswagen", Model: "Passat", Colour: "yellow", Owner: "Max", Price: 8000},
-		Car{Make: "Tesla", Model: "S", Colour: "black", Owner: "Adriana", Price: 69000},
-		Car{Make: "Peugeot", Model: "205", Colour: "purple", Owner: "Michel", Price: 15000},
-		Car{Make: "Chery", Model: "S22L", Colour: "white", Owner: "Aarav", Price: 20000},
-		Car{Make: "Fiat", Model: "Punto", Colour: "violet", Owner: "Pari", Price: 3000},
-		Car{Make: "Tata", Model: "Nano", Colour: "indigo", Owner: "Valeria", Price: 1000},
-		Car{Make: "Holden", Model: "Barina", Colour: "brown", Owner: "Shotaro", Price: 10000},
+		Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Price: moneyFromWholeUnits(10000, defaultCurrency)},
+		Car{Make: "Ford", Model: "Mustang", Colour: "red", Owner: "Brad", Price: moneyFromWholeUnits(20000, defaultCurrency)},
+		Car{Make: "Hyundai", Model: "Tucson", Colour: "green", Owner: "Jin Soo", Price: moneyFromWholeUnits(8000, defaultCurrency)},
+		Car{Make: "Volkswagen", Model: "Passat", Colour: "yellow", Owner: "Max", Price: moneyFromWholeUnits(8000, defaultCurrency)},
+		Car{Make: "Tesla", Model: "S", Colour: "black", Owner: "Adriana", Price: moneyFromWholeUnits(69000, defaultCurrency)},
+		Car{Make: "Peugeot", Model: "205", Colour: "purple", Owner: "Michel", Price: moneyFromWholeUnits(15000, defaultCurrency)},
+		Car{Make: "Chery", Model: "S22L", Colour: "white", Owner: "Aarav", Price: moneyFromWholeUnits(20000, defaultCurrency)},
+		Car{Make: "Fiat", Model: "Punto", Colour: "violet", Owner: "Pari", Price: moneyFromWholeUnits(3000, defaultCurrency)},
+		Car{Make: "Tata", Model: "Nano", Colour: "indigo", Owner: "Valeria", Price: moneyFromWholeUnits(1000, defaultCurrency)},
+		Car{Make: "Holden", Model: "Barina", Colour: "brown", Owner: "Shotaro", Price: moneyFromWholeUnits(10000, defaultCurrency)},
 	}
 
+	changes := []CarChange{}
+
 	for i, car := range cars {
-		carAsBytes, _ := json.Marshal(car)
-		err := ctx.GetStub().PutState("CAR"+strconv.Itoa(i), carAsBytes)
+		car.Status = StatusRegistered
 
-		if err != nil {
-			return fmt.Errorf("Failed to put to world state. %s", err.Error())
+		if err := putCar(ctx, "CAR"+strconv.Itoa(i), &car); err != nil {
+			return err
 		}
+
+		if err := putOwnerIndex(ctx, car.Owner, "CAR"+strconv.Itoa(i), car.OwnerMSP); err != nil {
+			return err
+		}
+
+		if err := recordPriceChange(ctx, "CAR"+strconv.Itoa(i), &car); err != nil {
+			return err
+		}
+
+		created := car
+		changes = append(changes, CarChange{CarNumber: "CAR" + strconv.Itoa(i), After: &created})
 	}
 
-	return nil
+	return emitCarEvent(ctx, carCreatedEvent, changes...)
 }
 
-// CreateCar adds a new car to the world state with given details
-func (s *SmartContract) CreateCar(ctx contractapi.TransactionContextInterface, carNumber string, make string, model string, colour string, owner string, price int) error {
+// CreateCar adds a new car with given VIN and details to the world state. The
+// car is stored under carNumber, which stays usable as an alias of the VIN, or
+// under the VIN when carNumber is empty. The car is bound to the identity of
+// the submitting client, owner is kept as a display name. The price is given in
+// the minor unit of the ISO 4217 currency. Invalid details, existing car
+// numbers and registered VINs are rejected with a ContractError
+func (s *SmartContract) CreateCar(ctx contractapi.TransactionContextInterface, carNumber string, vin string, make string, model string, colour string, owner string, price int64, currency string) error {
 	car := Car{
 		Make:   make,
 		Model:  model,
 		Colour: colour,
 		Owner:  owner,
-		Price: price,
+		Price:  Money{Amount: price, Currency: currency},
+		Status: StatusRegistered,
+		VIN:    normalizeVIN(vin),
+	}
+
+	if carNumber == "" {
+		carNumber = car.VIN
+	}
+
+	if err := validateCar(carNumber, &car); err != nil {
+		return err
+	}
+
+	if err := assertCarDoesNotExist(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := assertVINNotRegistered(ctx, car.VIN, carNumber); err != nil {
+		return err
 	}
 
-	carAsBytes, _ := json.Marshal(car)
+	ownerMSP, ownerID, err := getSubmittingClientIdentity(ctx)
 
-	return ctx.GetStub().PutState(carNumber, carAsBytes)
+	if err != nil {
+		return err
+	}
+
+	car.OwnerMSP = ownerMSP
+	car.OwnerID = ownerID
+
+	if err := storeNewCar(ctx, carNumber, &car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, carCreatedEvent, CarChange{CarNumber: carNumber, After: &car})
 }
 
 // QueryCar returns the car stored in the world state with given id
@@ -86,10 +167,7 @@ func (s *SmartContract) QueryCar(ctx contractapi.TransactionContextInterface, ca
 		return nil, fmt.Errorf("%s does not exist", carNumber)
 	}
 
-	car := new(Car)
-	_ = json.Unmarshal(carAsBytes, car)
-
-	return car, nil
+	return decodeCar(carNumber, carAsBytes)
 }
 
 // QueryAllCars returns all cars found in world state
@@ -104,6 +182,206 @@ func (s *SmartContract) QueryAllCars(ctx contractapi.TransactionContextInterface
 	}
 	defer resultsIterator.Close()
 
+	return constructQueryResults(resultsIterator)
+}
+
+// QueryAllCarsWithPagination returns a page of at most pageSize cars found in
+// world state starting at bookmark, together with the bookmark of the next page
+func (s *SmartContract) QueryAllCarsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	startKey := ""
+	endKey := ""
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results, err := constructQueryResults(resultsIterator)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             results,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// GetCarHistory returns every version of the car with given id recorded on the
+// ledger, oldest first, so the provenance of a car can be reconstructed
+func (s *SmartContract) GetCarHistory(ctx contractapi.TransactionContextInterface, carNumber string) ([]HistoryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(carNumber)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history of %s. %s", carNumber, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	results := []HistoryResult{}
+
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		historyResult := HistoryResult{TxID: modification.TxId, IsDelete: modification.IsDelete}
+
+		if modification.Timestamp != nil {
+			timestamp := time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos))
+			historyResult.Timestamp = timestamp.UTC().Format(time.RFC3339Nano)
+		}
+
+		if !modification.IsDelete {
+			car, err := decodeCar(carNumber, modification.Value)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to decode %s at transaction %s. %s", carNumber, modification.TxId, err.Error())
+			}
+
+			historyResult.Record = car
+		}
+
+		results = append(results, historyResult)
+	}
+
+	return results, nil
+}
+
+// ChangeCarPrice sets the price of the car with given id to newPrice in the
+// minor unit of the ISO 4217 currency. Only the currently recorded owner may
+// change the price. The price and the client changing it are added to the
+// price history of the car. Prices agreed between a seller and a buyer that
+// must stay confidential are negotiated with OpenPriceNegotiation
+func (s *SmartContract) ChangeCarPrice(ctx contractapi.TransactionContextInterface, carNumber string, newPrice int64, currency string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return err
+	}
+
+	price := Money{Amount: newPrice, Currency: currency}
+
+	if err := validateMoney("price of "+carNumber, price); err != nil {
+		return err
+	}
+
+	before := *car
+	car.Price = price
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := recordPriceChange(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, priceChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// ChangeCarOwner transfers the car with given id to a new owner identity. Only
+// the currently recorded owner may submit the transfer and stolen or scrapped
+// cars, cars with an active lien or cars being auctioned cannot be transferred.
+// The car is Registered to its new owner
+func (s *SmartContract) ChangeCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, newOwner string, newOwnerMSP string, newOwnerID string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(newOwner) == "" {
+		return newContractError(CodeInvalidArgument, "owner of %s must not be empty", carNumber)
+	}
+
+	if newOwnerMSP == "" || newOwnerID == "" {
+		return fmt.Errorf("New owner MSP ID and client ID must be provided")
+	}
+
+	if err := assertNoOpenAuction(ctx, carNumber); err != nil {
+		return err
+	}
+
+	before := *car
+
+	if currentCarStatus(car) == StatusRegistered {
+		car.Status = StatusRegistered
+	} else if err := transitionCarStatus(carNumber, car, StatusRegistered); err != nil {
+		return err
+	}
+
+	if err := transferCar(ctx, carNumber, car, newOwner, newOwnerMSP, newOwnerID); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, ownerChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// BindCarOwner binds a car without an owner identity, such as those written by
+// InitLedger before owners were tracked, to the given identity. Only admins of
+// the registry organisation may bind cars and already bound cars are rejected
+func (s *SmartContract) BindCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, ownerMSP string, ownerID string) error {
+	if err := assertRegistryAdmin(ctx); err != nil {
+		return err
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if car.OwnerMSP != "" || car.OwnerID != "" {
+		return fmt.Errorf("%s is already bound to an owner identity", carNumber)
+	}
+
+	if ownerMSP == "" || ownerID == "" {
+		return fmt.Errorf("Owner MSP ID and client ID must be provided")
+	}
+
+	before := *car
+	car.OwnerMSP = ownerMSP
+	car.OwnerID = ownerID
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := setCarEndorsementPolicy(ctx, carNumber, ownerMSP); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, ownerBoundEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// constructQueryResults reads every car from the iterator into query results
+func constructQueryResults(resultsIterator shim.StateQueryIteratorInterface) ([]QueryResult, error) {
 	results := []QueryResult{}
 
 	for resultsIterator.HasNext() {
@@ -113,8 +391,11 @@ func (s *SmartContract) QueryAllCars(ctx contractapi.TransactionContextInterface
 			return nil, err
 		}
 
-		car := new(Car)
-		_ = json.Unmarshal(queryResponse.Value, car)
+		car, err := decodeCar(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			return nil, err
+		}
 
 		queryResult := QueryResult{Key: queryResponse.Key, Record: car}
 		results = append(results, queryResult)
@@ -123,34 +404,280 @@ func (s *SmartContract) QueryAllCars(ctx contractapi.TransactionContextInterface
 	return results, nil
 }
 
-// ChangeCarOwner updates the owner field of car with given id in world state
-func (s *SmartContract) ChangeCarPrice(ctx contractapi.TransactionContextInterface, carNumber string, newPrice int) error {
-	car, err := s.QueryCar(ctx, carNumber)
+// putCar stores the car under carNumber in world state in the current schema version
+func putCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	car.SchemaVersion = currentCarSchemaVersion
+	carAsBytes, err := json.Marshal(car)
 
 	if err != nil {
+		return fmt.Errorf("Failed to encode %s. %s", carNumber, err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(carNumber, carAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// validateCar checks the car number format, the VIN and the details every car requires
+func validateCar(carNumber string, car *Car) error {
+	if !carNumberPattern.MatchString(carNumber) {
+		return newContractError(CodeInvalidArgument, "Car number %q must be 1 to 64 letters, digits, '-' or '_'", carNumber)
+	}
+
+	if err := validateVIN(car.VIN); err != nil {
 		return err
 	}
 
-	car.Price = newPrice
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"make", car.Make},
+		{"model", car.Model},
+		{"colour", car.Colour},
+		{"owner", car.Owner},
+	}
 
-	carAsBytes, _ := json.Marshal(car)
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return newContractError(CodeInvalidArgument, "%s of %s must not be empty", field.name, carNumber)
+		}
+	}
+
+	if err := validateMoney("price of "+carNumber, car.Price); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(carNumber, carAsBytes)
+	return nil
 }
 
-// ChangeCarOwner updates the owner field of car with given id in world state
-func (s *SmartContract) ChangeCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, newOwner string) error {
-	car, err := s.QueryCar(ctx, carNumber)
+// assertCarDoesNotExist returns an AlreadyExists error if a car is stored under carNumber
+func assertCarDoesNotExist(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	carAsBytes, err := ctx.GetStub().GetState(carNumber)
 
 	if err != nil {
+		return fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if carAsBytes != nil {
+		return newContractError(CodeAlreadyExists, "%s already exists", carNumber)
+	}
+
+	return nil
+}
+
+// storeNewCar writes a validated new car with its endorsement policy, index
+// entries and first price history entry
+func storeNewCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := setCarEndorsementPolicy(ctx, carNumber, car.OwnerMSP); err != nil {
+		return err
+	}
+
+	if err := putOwnerIndex(ctx, car.Owner, carNumber, car.OwnerMSP); err != nil {
+		return err
+	}
+
+	if err := putVINIndex(ctx, car.VIN, carNumber, car.OwnerMSP); err != nil {
+		return err
+	}
+
+	return recordPriceChange(ctx, carNumber, car)
+}
+
+// transferCar moves the car to a new owner identity unless an active lien is
+// registered on it. It keeps the owner index in sync, requires the new owner
+// organisation to endorse later changes to the car and its auction record and
+// withdraws any sale listing and
+// offers made to the previous owner. Callers set the status the car ends up in
+// before transferring it
+func transferCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car, newOwner string, newOwnerMSP string, newOwnerID string) error {
+	if err := assertNoActiveLien(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := deleteOwnerIndex(ctx, car.Owner, carNumber); err != nil {
 		return err
 	}
 
 	car.Owner = newOwner
+	car.OwnerMSP = newOwnerMSP
+	car.OwnerID = newOwnerID
 
-	carAsBytes, _ := json.Marshal(car)
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := setCarEndorsementPolicy(ctx, carNumber, newOwnerMSP); err != nil {
+		return err
+	}
+
+	if err := putOwnerIndex(ctx, newOwner, carNumber, newOwnerMSP); err != nil {
+		return err
+	}
+
+	if err := setAuctionEndorsementPolicy(ctx, carNumber, newOwnerMSP); err != nil {
+		return err
+	}
+
+	return clearSale(ctx, carNumber)
+}
+
+// getTxTime returns the timestamp of the current transaction, which is the
+// same on every endorsing peer unlike the local clock
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to read transaction timestamp. %s", err.Error())
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+// putCompositeObject stores value as JSON under the composite key built from objectType and attributes
+func putCompositeObject(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, value interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	valueAsBytes, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s. %s", objectType, err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(key, valueAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// putCarObject stores value like putCompositeObject under a composite key whose
+// first attribute is the car id and gives the key the endorsement policy of the
+// car owned by ownerMSP
+func putCarObject(ctx contractapi.TransactionContextInterface, ownerMSP string, objectType string, attributes []string, value interface{}) error {
+	if err := putCompositeObject(ctx, objectType, attributes, value); err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	return setCarObjectEndorsementPolicy(ctx, attributes[0], key, ownerMSP)
+}
+
+// getCompositeObject decodes the JSON stored under the composite key into value,
+// reporting whether it was found
+func getCompositeObject(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, value interface{}) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	valueAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if valueAsBytes == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(valueAsBytes, value); err != nil {
+		return false, fmt.Errorf("Failed to decode %s. %s", objectType, err.Error())
+	}
+
+	return true, nil
+}
+
+// deleteCompositeObject removes the value stored under the composite key
+func deleteCompositeObject(ctx contractapi.TransactionContextInterface, objectType string, attributes []string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return fmt.Errorf("Failed to delete from world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// getSubmittingClientIdentity returns the MSP ID and client ID of the submitting client
+func getSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read client ID. %s", err.Error())
+	}
+
+	return mspID, clientID, nil
+}
+
+// assertCarOwner returns an error unless the submitting client is the recorded owner of the car
+func assertCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	if car.OwnerMSP == "" || car.OwnerID == "" {
+		return fmt.Errorf("%s has no owner identity, it must be bound with BindCarOwner first", carNumber)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if mspID != car.OwnerMSP || clientID != car.OwnerID {
+		return fmt.Errorf("Submitting client is not the owner of %s", carNumber)
+	}
+
+	return nil
+}
+
+// assertRegistryAdmin returns an error unless the submitting client is an admin of the registry organisation
+func assertRegistryAdmin(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client certificate. %s", err.Error())
+	}
+
+	if mspID == registryMSPID && cert != nil {
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if ou == "admin" {
+				return nil
+			}
+		}
+	}
 
-	return ctx.GetStub().PutState(carNumber, carAsBytes)
+	return fmt.Errorf("Submitting client is not a %s admin", registryMSPID)
 }
 
 func main() {
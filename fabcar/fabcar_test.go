@@ -0,0 +1,452 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// fabcarTest is a test network with the contract and a client of every role
+type fabcarTest struct {
+	*testNetwork
+	contract *SmartContract
+	admin    *testClient
+	alice    *testClient
+	bob      *testClient
+	bank     *testClient
+	police   *testClient
+}
+
+func newFabcarTest(t *testing.T) *fabcarTest {
+	return &fabcarTest{
+		testNetwork: newTestNetwork(t),
+		contract:    new(SmartContract),
+		admin:       newTestClient(t, registryMSPID, "Admin@org1", "admin"),
+		alice:       newTestClient(t, "Org1MSP", "alice", "client"),
+		bob:         newTestClient(t, "Org2MSP", "bob", "client"),
+		bank:        newTestClient(t, lenderMSPIDs[0], "bank", "client"),
+		police:      newTestClient(t, authorityMSPID, "police", "client"),
+	}
+}
+
+// initLedger submits InitLedger as the registry admin
+func (f *fabcarTest) initLedger() {
+	f.t.Helper()
+
+	assertNoError(f.t, f.submit(f.admin, f.contract.InitLedger))
+}
+
+// createCar creates a car of the client priced 1000.00 USD and returns its VIN
+func (f *fabcarTest) createCar(owner *testClient, carNumber string) string {
+	f.t.Helper()
+
+	vin := testVIN(f.txCount + 1)
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CreateCar(ctx, carNumber, vin, "Volkswagen", "Polo", "white", "Alice", 100000, "USD")
+	}))
+
+	return vin
+}
+
+// queryCar returns the committed car stored under carNumber
+func (f *fabcarTest) queryCar(carNumber string) *Car {
+	f.t.Helper()
+
+	var car *Car
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		car, err = f.contract.QueryCar(ctx, carNumber)
+		return err
+	}))
+
+	return car
+}
+
+// lastCarEvent decodes the event of the last committed transaction
+func (f *fabcarTest) lastCarEvent() CarEvent {
+	f.t.Helper()
+
+	if f.lastEvent == nil {
+		f.t.Fatalf("last transaction emitted no event")
+	}
+
+	event := CarEvent{}
+
+	if err := json.Unmarshal(f.lastEvent.Payload, &event); err != nil {
+		f.t.Fatalf("failed to decode event: %v", err)
+	}
+
+	if event.Type != f.lastEvent.EventName {
+		f.t.Fatalf("event %s has type %s", f.lastEvent.EventName, event.Type)
+	}
+
+	return event
+}
+
+// testVIN returns a valid VIN unique for the serial number
+func testVIN(serial int) string {
+	vin := []byte(fmt.Sprintf("1M8GDM9A0KP%06d", serial))
+
+	for _, checkDigit := range "0123456789X" {
+		vin[vinCheckDigitPosition] = byte(checkDigit)
+
+		if validateVIN(string(vin)) == nil {
+			break
+		}
+	}
+
+	return string(vin)
+}
+
+// assertContractError fails the test unless err is a ContractError with the code
+func assertContractError(t *testing.T, err error, code ErrorCode) {
+	t.Helper()
+
+	contractErr := new(ContractError)
+
+	if !errors.As(err, &contractErr) {
+		t.Fatalf("expected ContractError %s, got %v", code, err)
+	}
+
+	if contractErr.Code != code {
+		t.Fatalf("expected ContractError %s, got %s", code, contractErr.Error())
+	}
+}
+
+func TestContractIsValidChaincode(t *testing.T) {
+	_, err := contractapi.NewChaincode(new(SmartContract))
+
+	assertNoError(t, err)
+}
+
+func TestInitLedger(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+
+	car := f.queryCar("CAR0")
+	assertEqual(t, *car, Car{
+		Make:          "Toyota",
+		Model:         "Prius",
+		Colour:        "blue",
+		Owner:         "Tomoko",
+		Price:         Money{Amount: 1000000, Currency: defaultCurrency},
+		Status:        StatusRegistered,
+		SchemaVersion: currentCarSchemaVersion,
+	})
+	assertEqual(t, f.queryCar("CAR9").Make, "Holden")
+
+	event := f.lastCarEvent()
+	assertEqual(t, event.Type, carCreatedEvent)
+	assertEqual(t, event.Version, carEventVersion)
+	assertEqual(t, len(event.Changes), 10)
+	assertEqual(t, event.Changes[9].CarNumber, "CAR9")
+}
+
+func TestCreateCar(t *testing.T) {
+	f := newFabcarTest(t)
+	vin := f.createCar(f.alice, "CAR10")
+
+	assertEqual(t, *f.queryCar("CAR10"), Car{
+		Make:          "Volkswagen",
+		Model:         "Polo",
+		Colour:        "white",
+		Owner:         "Alice",
+		OwnerMSP:      f.alice.MSPID,
+		OwnerID:       f.alice.ID,
+		Price:         Money{Amount: 100000, Currency: "USD"},
+		Status:        StatusRegistered,
+		VIN:           vin,
+		SchemaVersion: currentCarSchemaVersion,
+	})
+
+	event := f.lastCarEvent()
+	assertEqual(t, event.Type, carCreatedEvent)
+	assertEqual(t, event.TxID, f.stub.history["CAR10"][0].TxId)
+	assertEqual(t, event.Changes[0].Before, (*Car)(nil))
+	assertEqual(t, event.Changes[0].After.VIN, vin)
+}
+
+func TestCreateCarUnderVIN(t *testing.T) {
+	f := newFabcarTest(t)
+	vin := f.createCar(f.alice, "")
+
+	assertEqual(t, f.queryCar(vin).VIN, vin)
+}
+
+func TestCreateCarRejectsInvalidDetails(t *testing.T) {
+	tests := []struct {
+		name      string
+		carNumber string
+		vin       string
+		make      string
+		price     int64
+		currency  string
+	}{
+		{"car number with space", "CAR 1", testVIN(1), "Volkswagen", 1, "USD"},
+		{"empty make", "CAR1", testVIN(1), " ", 1, "USD"},
+		{"negative price", "CAR1", testVIN(1), "Volkswagen", -1, "USD"},
+		{"unknown currency", "CAR1", testVIN(1), "Volkswagen", 1, "XXX"},
+		{"short VIN", "CAR1", "1M8GDM9AXKP04278", "Volkswagen", 1, "USD"},
+		{"wrong check digit", "CAR1", "1M8GDM9A1KP042788", "Volkswagen", 1, "USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFabcarTest(t)
+
+			err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+				return f.contract.CreateCar(ctx, tt.carNumber, tt.vin, tt.make, "Polo", "white", "Alice", tt.price, tt.currency)
+			})
+
+			assertContractError(t, err, CodeInvalidArgument)
+			assertEqual(t, len(f.stub.State), 0)
+		})
+	}
+}
+
+func TestCreateCarRejectsDuplicates(t *testing.T) {
+	f := newFabcarTest(t)
+	vin := f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CreateCar(ctx, "CAR10", testVIN(99), "Ford", "Focus", "red", "Bob", 1, "EUR")
+	})
+	assertContractError(t, err, CodeAlreadyExists)
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CreateCar(ctx, "CAR11", vin, "Ford", "Focus", "red", "Bob", 1, "EUR")
+	})
+	assertContractError(t, err, CodeAlreadyExists)
+
+	assertEqual(t, f.queryCar("CAR10").Make, "Volkswagen")
+}
+
+func TestQueryCarNotFound(t *testing.T) {
+	f := newFabcarTest(t)
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCar(ctx, "CAR404")
+		return err
+	})
+
+	assertErrorContains(t, err, "CAR404 does not exist")
+}
+
+func TestQueryAllCars(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryAllCars(ctx)
+		return err
+	}))
+
+	keys := []string{}
+
+	for _, result := range results {
+		keys = append(keys, result.Key)
+	}
+
+	assertEqual(t, keys, []string{"CAR0", "CAR1", "CAR10", "CAR2", "CAR3", "CAR4", "CAR5", "CAR6", "CAR7", "CAR8", "CAR9"})
+	assertEqual(t, results[2].Record.Owner, "Alice")
+}
+
+func TestQueryAllCarsEmptyLedger(t *testing.T) {
+	f := newFabcarTest(t)
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryAllCars(ctx)
+		return err
+	}))
+
+	assertEqual(t, results, []QueryResult{})
+}
+
+func TestQueryAllCarsWithPagination(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+
+	bookmark := ""
+	pages := [][]string{}
+
+	for {
+		var page *PaginatedQueryResult
+
+		assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+			page, err = f.contract.QueryAllCarsWithPagination(ctx, 4, bookmark)
+			return err
+		}))
+
+		keys := []string{}
+
+		for _, record := range page.Records {
+			keys = append(keys, record.Key)
+		}
+
+		assertEqual(t, page.FetchedRecordsCount, int32(len(keys)))
+		pages = append(pages, keys)
+
+		if page.Bookmark == "" {
+			break
+		}
+
+		bookmark = page.Bookmark
+	}
+
+	assertEqual(t, pages, [][]string{{"CAR0", "CAR1", "CAR2", "CAR3"}, {"CAR4", "CAR5", "CAR6", "CAR7"}, {"CAR8", "CAR9"}})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryAllCarsWithPagination(ctx, 0, "")
+		return err
+	})
+	assertErrorContains(t, err, "Page size must be greater than zero")
+}
+
+func TestGetCarHistory(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", 90000, "USD")
+	}))
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+
+	var history []HistoryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		history, err = f.contract.GetCarHistory(ctx, "CAR10")
+		return err
+	}))
+
+	assertEqual(t, len(history), 3)
+	assertEqual(t, history[0].TxID, "tx0001")
+	assertEqual(t, history[0].Timestamp, "2021-01-01T00:00:01Z")
+	assertEqual(t, history[0].Record.Price.Amount, int64(100000))
+	assertEqual(t, history[1].Record.Price.Amount, int64(90000))
+	assertEqual(t, history[2].Record.Owner, "Bob")
+	assertEqual(t, history[2].IsDelete, false)
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		history, err = f.contract.GetCarHistory(ctx, "CAR404")
+		return err
+	}))
+	assertEqual(t, history, []HistoryResult{})
+}
+
+func TestChangeCarPrice(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", 5000, "EUR")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+	assertEqual(t, f.queryCar("CAR10").Price, Money{Amount: 100000, Currency: "USD"})
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", 5000, "EUR")
+	}))
+	assertEqual(t, f.queryCar("CAR10").Price, Money{Amount: 5000, Currency: "EUR"})
+
+	event := f.lastCarEvent()
+	assertEqual(t, event.Type, priceChangedEvent)
+	assertEqual(t, event.Changes[0].Before.Price, Money{Amount: 100000, Currency: "USD"})
+	assertEqual(t, event.Changes[0].After.Price, Money{Amount: 5000, Currency: "EUR"})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", -5, "EUR")
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR404", 5, "EUR")
+	})
+	assertErrorContains(t, err, "CAR404 does not exist")
+	assertEqual(t, f.queryCar("CAR10").Price.Amount, int64(5000))
+}
+
+func TestChangeCarOwner(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", "", "")
+	})
+	assertErrorContains(t, err, "New owner MSP ID and client ID must be provided")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", " ", f.bob.MSPID, f.bob.ID)
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+	assertEqual(t, f.queryCar("CAR10").Owner, "Alice")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Owner, "Bob")
+	assertEqual(t, car.OwnerMSP, f.bob.MSPID)
+	assertEqual(t, car.OwnerID, f.bob.ID)
+	assertEqual(t, f.lastCarEvent().Type, ownerChangedEvent)
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Alice", f.alice.MSPID, f.alice.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR404", "Bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "CAR404 does not exist")
+}
+
+func TestBindCarOwner(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR1", "Alice", f.alice.MSPID, f.alice.ID)
+	})
+	assertErrorContains(t, err, "CAR1 has no owner identity")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.BindCarOwner(ctx, "CAR1", f.alice.MSPID, f.alice.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is not a Org1MSP admin")
+
+	assertNoError(t, f.submit(f.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.BindCarOwner(ctx, "CAR1", f.alice.MSPID, f.alice.ID)
+	}))
+	assertEqual(t, f.queryCar("CAR1").OwnerID, f.alice.ID)
+	assertEqual(t, f.lastCarEvent().Type, ownerBoundEvent)
+
+	err = f.submit(f.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.BindCarOwner(ctx, "CAR1", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "CAR1 is already bound to an owner identity")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR1", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+}
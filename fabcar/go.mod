@@ -2,4 +2,9 @@ module github.com/hyperledger/fabric-samples/chaincode/fabcar/go
 
 go 1.16
 
-require github.com/hyperledger/fabric-contract-api-go v1.1.0
+require (
+	github.com/golang/protobuf v1.3.2
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
+	github.com/hyperledger/fabric-contract-api-go v1.1.0
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
+)
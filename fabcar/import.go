@@ -0,0 +1,140 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxImportSize is the number of cars ImportCars accepts in one transaction,
+// keeping its read and write sets within what peers handle comfortably
+const maxImportSize = 500
+
+// CarImport describes a car passed to ImportCars. The car is stored under the
+// VIN when CarNumber is empty, like with CreateCar
+type CarImport struct {
+	CarNumber string `json:"carNumber"`
+	VIN       string `json:"vin"`
+	Make      string `json:"make"`
+	Model     string `json:"model"`
+	Colour    string `json:"colour"`
+	Owner     string `json:"owner"`
+	Price     Money  `json:"price"`
+}
+
+// ImportCars creates every car of carsJSON, a JSON array of CarImport, bound
+// to the submitting client in a single transaction. Each car is validated like
+// with CreateCar and against the other cars of the import. If any car is
+// rejected nothing is written and the ContractError lists every rejected car
+func (s *SmartContract) ImportCars(ctx contractapi.TransactionContextInterface, carsJSON string) error {
+	imports := []CarImport{}
+	decoder := json.NewDecoder(strings.NewReader(carsJSON))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&imports); err != nil {
+		return newContractError(CodeInvalidArgument, "cars must be a JSON array of cars. %s", err.Error())
+	}
+
+	if len(imports) == 0 || len(imports) > maxImportSize {
+		return newContractError(CodeInvalidArgument, "cars must contain 1 to %d cars, got %d", maxImportSize, len(imports))
+	}
+
+	ownerMSP, ownerID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	carNumbers := make([]string, len(imports))
+	cars := make([]Car, len(imports))
+	seenCarNumbers := map[string]int{}
+	seenVINs := map[string]int{}
+	itemErrors := []ItemError{}
+
+	for i, item := range imports {
+		car := Car{
+			Make:     item.Make,
+			Model:    item.Model,
+			Colour:   item.Colour,
+			Owner:    item.Owner,
+			OwnerMSP: ownerMSP,
+			OwnerID:  ownerID,
+			Price:    item.Price,
+			Status:   StatusRegistered,
+			VIN:      normalizeVIN(item.VIN),
+		}
+
+		carNumber := item.CarNumber
+
+		if carNumber == "" {
+			carNumber = car.VIN
+		}
+
+		carNumbers[i], cars[i] = carNumber, car
+
+		if err := validateImportedCar(ctx, carNumber, &car, seenCarNumbers, seenVINs); err != nil {
+			contractErr := new(ContractError)
+
+			if !errors.As(err, &contractErr) {
+				return err
+			}
+
+			itemErrors = append(itemErrors, ItemError{Index: i, Key: carNumber, Code: contractErr.Code, Message: contractErr.Message})
+		}
+
+		if _, ok := seenCarNumbers[carNumber]; !ok {
+			seenCarNumbers[carNumber] = i
+		}
+
+		if _, ok := seenVINs[car.VIN]; !ok {
+			seenVINs[car.VIN] = i
+		}
+	}
+
+	if len(itemErrors) > 0 {
+		importErr := newContractError(CodeInvalidArgument, "%d of %d cars were rejected, none were imported", len(itemErrors), len(imports))
+		importErr.Items = itemErrors
+
+		return importErr
+	}
+
+	changes := []CarChange{}
+
+	for i := range cars {
+		if err := storeNewCar(ctx, carNumbers[i], &cars[i]); err != nil {
+			return err
+		}
+
+		changes = append(changes, CarChange{CarNumber: carNumbers[i], After: &cars[i]})
+	}
+
+	return emitCarEvent(ctx, carCreatedEvent, changes...)
+}
+
+// validateImportedCar applies the CreateCar checks to a car of an import and
+// rejects car numbers and VINs already used by an earlier car of the import
+func validateImportedCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car, seenCarNumbers map[string]int, seenVINs map[string]int) error {
+	if err := validateCar(carNumber, car); err != nil {
+		return err
+	}
+
+	if i, ok := seenCarNumbers[carNumber]; ok {
+		return newContractError(CodeAlreadyExists, "%s is already used by car %d of the import", carNumber, i)
+	}
+
+	if i, ok := seenVINs[car.VIN]; ok {
+		return newContractError(CodeAlreadyExists, "VIN %s is already used by car %d of the import", car.VIN, i)
+	}
+
+	if err := assertCarDoesNotExist(ctx, carNumber); err != nil {
+		return err
+	}
+
+	return assertVINNotRegistered(ctx, car.VIN, carNumber)
+}
@@ -0,0 +1,102 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// importCars submits the cars as JSON to ImportCars
+func (f *fabcarTest) importCars(owner *testClient, cars []CarImport) error {
+	f.t.Helper()
+
+	carsJSON, err := json.Marshal(cars)
+
+	if err != nil {
+		f.t.Fatalf("failed to encode cars: %v", err)
+	}
+
+	return f.submit(owner, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ImportCars(ctx, string(carsJSON))
+	})
+}
+
+func TestImportCars(t *testing.T) {
+	f := newFabcarTest(t)
+
+	assertNoError(t, f.importCars(f.alice, []CarImport{
+		{CarNumber: "CAR10", VIN: testVIN(10), Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 150000, Currency: "EUR"}},
+		{VIN: testVIN(11), Make: "Kia", Model: "Rio", Colour: "blue", Owner: "Alice", Price: Money{Amount: 2000000, Currency: "JPY"}},
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.OwnerID, f.alice.ID)
+	assertEqual(t, car.Status, StatusRegistered)
+	assertEqual(t, f.queryCar(testVIN(11)).Price, Money{Amount: 2000000, Currency: "JPY"})
+	assertEqual(t, f.queryCarsByOwner("Alice"), []string{testVIN(11), "CAR10"})
+
+	event := f.lastCarEvent()
+	assertEqual(t, event.Type, carCreatedEvent)
+	assertEqual(t, len(event.Changes), 2)
+}
+
+func TestImportCarsIsAtomic(t *testing.T) {
+	f := newFabcarTest(t)
+	vin := f.createCar(f.alice, "CAR10")
+
+	err := f.importCars(f.alice, []CarImport{
+		{CarNumber: "CAR11", VIN: testVIN(11), Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 1, Currency: "EUR"}},
+		{CarNumber: "CAR10", VIN: testVIN(12), Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 1, Currency: "EUR"}},
+		{CarNumber: "CAR13", VIN: vin, Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 1, Currency: "EUR"}},
+		{CarNumber: "CAR11", VIN: testVIN(14), Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 1, Currency: "EUR"}},
+		{CarNumber: "CAR15", VIN: testVIN(15), Make: "Ford", Model: "Focus", Colour: "red", Owner: "Alice", Price: Money{Amount: 1, Currency: "XXX"}},
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+
+	contractErr := err.(*ContractError)
+	assertEqual(t, contractErr.Message, "4 of 5 cars were rejected, none were imported")
+
+	indexes := []int{}
+	codes := []ErrorCode{}
+
+	for _, item := range contractErr.Items {
+		indexes = append(indexes, item.Index)
+		codes = append(codes, item.Code)
+	}
+
+	assertEqual(t, indexes, []int{1, 2, 3, 4})
+	assertEqual(t, codes, []ErrorCode{CodeAlreadyExists, CodeAlreadyExists, CodeAlreadyExists, CodeInvalidArgument})
+
+	err = f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCar(ctx, "CAR11")
+		return err
+	})
+	assertErrorContains(t, err, "CAR11 does not exist")
+}
+
+func TestImportCarsRejectsMalformedInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		carsJSON string
+	}{
+		{"not an array", `{"carNumber":"CAR10"}`},
+		{"unknown field", `[{"carNumber":"CAR10","engine":"V8"}]`},
+		{"empty", `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFabcarTest(t)
+
+			err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+				return f.contract.ImportCars(ctx, tt.carsJSON)
+			})
+			assertContractError(t, err, CodeInvalidArgument)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ownerIndexName is the object type of the composite keys indexing cars by owner.
+// Composite keys are not returned by range queries so QueryAllCars skips them
+const ownerIndexName = "owner~carNumber"
+
+// QueryCarsByOwner returns all cars whose owner field matches owner. It reads
+// the owner composite key index and works with both LevelDB and CouchDB
+func (s *SmartContract) QueryCarsByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]QueryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ownerIndexName, []string{owner})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return s.constructQueryResultsFromIndex(ctx, resultsIterator)
+}
+
+// QueryCarsByOwnerWithPagination returns a page of cars whose owner field matches owner
+func (s *SmartContract) QueryCarsByOwnerWithPagination(ctx contractapi.TransactionContextInterface, owner string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(ownerIndexName, []string{owner}, pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results, err := s.constructQueryResultsFromIndex(ctx, resultsIterator)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             results,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// RebuildOwnerIndex writes owner index entries for every car in world state.
+// It backfills cars created before the index existed and is safe to repeat
+func (s *SmartContract) RebuildOwnerIndex(ctx contractapi.TransactionContextInterface) error {
+	if err := assertRegistryAdmin(ctx); err != nil {
+		return err
+	}
+
+	cars, err := s.QueryAllCars(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, car := range cars {
+		if err := putOwnerIndex(ctx, car.Record.Owner, car.Key, car.Record.OwnerMSP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// constructQueryResultsFromIndex resolves every owner index entry of the iterator to its car
+func (s *SmartContract) constructQueryResultsFromIndex(ctx contractapi.TransactionContextInterface, resultsIterator shim.StateQueryIteratorInterface) ([]QueryResult, error) {
+	results := []QueryResult{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to split index key. %s", err.Error())
+		}
+
+		carNumber := keyParts[len(keyParts)-1]
+		car, err := s.QueryCar(ctx, carNumber)
+
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, QueryResult{Key: carNumber, Record: car})
+	}
+
+	return results, nil
+}
+
+// putOwnerIndex adds the owner index entry for a car owned by ownerMSP
+func putOwnerIndex(ctx contractapi.TransactionContextInterface, owner string, carNumber string, ownerMSP string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ownerIndexName, []string{owner, carNumber})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create index key. %s", err.Error())
+	}
+
+	// only the key is needed, a value is stored because an empty value deletes the key
+	if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("Failed to put index to world state. %s", err.Error())
+	}
+
+	return setCarObjectEndorsementPolicy(ctx, carNumber, indexKey, ownerMSP)
+}
+
+// deleteOwnerIndex removes the owner index entry for a car
+func deleteOwnerIndex(ctx contractapi.TransactionContextInterface, owner string, carNumber string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ownerIndexName, []string{owner, carNumber})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create index key. %s", err.Error())
+	}
+
+	if err := ctx.GetStub().DelState(indexKey); err != nil {
+		return fmt.Errorf("Failed to delete index from world state. %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// queryCarsByOwner returns the keys of the cars indexed under owner
+func (f *fabcarTest) queryCarsByOwner(owner string) []string {
+	f.t.Helper()
+
+	var results []QueryResult
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByOwner(ctx, owner)
+		return err
+	}))
+
+	return resultKeys(results)
+}
+
+func TestQueryCarsByOwner(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+	f.createCar(f.alice, "CAR11")
+
+	assertEqual(t, f.queryCarsByOwner("Alice"), []string{"CAR10", "CAR11"})
+	assertEqual(t, f.queryCarsByOwner("Brad"), []string{"CAR1"})
+	assertEqual(t, f.queryCarsByOwner("Nobody"), []string{})
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+
+	assertEqual(t, f.queryCarsByOwner("Alice"), []string{"CAR11"})
+	assertEqual(t, f.queryCarsByOwner("Bob"), []string{"CAR10"})
+}
+
+func TestQueryCarsByOwnerWithPagination(t *testing.T) {
+	f := newFabcarTest(t)
+
+	for _, carNumber := range []string{"CAR10", "CAR11", "CAR12"} {
+		f.createCar(f.alice, carNumber)
+	}
+
+	var page *PaginatedQueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.QueryCarsByOwnerWithPagination(ctx, "Alice", 2, "")
+		return err
+	}))
+	assertEqual(t, resultKeys(page.Records), []string{"CAR10", "CAR11"})
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.QueryCarsByOwnerWithPagination(ctx, "Alice", 2, page.Bookmark)
+		return err
+	}))
+	assertEqual(t, resultKeys(page.Records), []string{"CAR12"})
+	assertEqual(t, page.Bookmark, "")
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCarsByOwnerWithPagination(ctx, "Alice", -1, "")
+		return err
+	})
+	assertErrorContains(t, err, "Page size must be greater than zero")
+}
+
+func TestRebuildOwnerIndex(t *testing.T) {
+	f := newFabcarTest(t)
+	f.stub.MockTransactionStart("legacy")
+	assertNoError(t, f.stub.MockStub.PutState("CAR0", []byte(`{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","price":10000}`)))
+	f.stub.MockTransactionEnd("legacy")
+
+	assertEqual(t, f.queryCarsByOwner("Tomoko"), []string{})
+
+	err := f.submit(f.alice, f.contract.RebuildOwnerIndex)
+	assertErrorContains(t, err, "Submitting client is not a Org1MSP admin")
+
+	assertNoError(t, f.submit(f.admin, f.contract.RebuildOwnerIndex))
+	assertEqual(t, f.queryCarsByOwner("Tomoko"), []string{"CAR0"})
+
+	assertNoError(t, f.submit(f.admin, f.contract.RebuildOwnerIndex))
+	assertEqual(t, f.queryCarsByOwner("Tomoko"), []string{"CAR0"})
+}
@@ -0,0 +1,262 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Liens are stored per car and indexed per lender under composite keys
+const (
+	lienObjectType      = "lien~carNumber~lienID"
+	lienLenderIndexName = "lender~carNumber~lienID"
+	lienStatusActive    = "Active"
+	lienStatusReleased  = "Released"
+)
+
+// lenderMSPIDs are the organisations whose clients may register liens
+var lenderMSPIDs = []string{"Org2MSP"}
+
+// Lien describes a financing claim of a lender on a car. Released liens are
+// kept for audit, only active liens block transfers
+type Lien struct {
+	LienID       string `json:"lienID"`
+	CarNumber    string `json:"carNumber"`
+	LenderMSP    string `json:"lenderMSP"`
+	LenderID     string `json:"lenderID"`
+	Amount       Money  `json:"amount"`
+	LienStatus   string `json:"lienStatus"`
+	RegisteredAt string `json:"registeredAt"`
+	ReleasedAt   string `json:"releasedAt,omitempty"`
+}
+
+// RegisterLien records a lien of amount, in the minor unit of the ISO 4217
+// currency, on the car with given id on behalf of the submitting client, who
+// must belong to a lender organisation. The lien id, the transaction id, is
+// returned
+func (s *SmartContract) RegisterLien(ctx contractapi.TransactionContextInterface, carNumber string, amount int64, currency string) (string, error) {
+	lenderMSP, lenderID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !containsString(lenderMSPIDs, lenderMSP) {
+		return "", fmt.Errorf("Submitting client is not a member of a lender organisation")
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return "", err
+	}
+
+	lienAmount := Money{Amount: amount, Currency: currency}
+
+	if err := validateMoney("lien amount", lienAmount); err != nil {
+		return "", err
+	}
+
+	if amount == 0 {
+		return "", fmt.Errorf("Lien amount must be greater than zero")
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	lien := Lien{
+		LienID:       ctx.GetStub().GetTxID(),
+		CarNumber:    carNumber,
+		LenderMSP:    lenderMSP,
+		LenderID:     lenderID,
+		Amount:       lienAmount,
+		LienStatus:   lienStatusActive,
+		RegisteredAt: now.Format(time.RFC3339),
+	}
+
+	if err := putCarObject(ctx, car.OwnerMSP, lienObjectType, []string{carNumber, lien.LienID}, lien); err != nil {
+		return "", err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(lienLenderIndexName, []string{lenderMSP, lenderID, carNumber, lien.LienID})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create index key. %s", err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+		return "", fmt.Errorf("Failed to put index to world state. %s", err.Error())
+	}
+
+	if err := setCarObjectEndorsementPolicy(ctx, carNumber, indexKey, car.OwnerMSP); err != nil {
+		return "", err
+	}
+
+	return lien.LienID, nil
+}
+
+// ReleaseLien marks an active lien on the car with given id released. Only the
+// lender who registered the lien may release it
+func (s *SmartContract) ReleaseLien(ctx contractapi.TransactionContextInterface, carNumber string, lienID string) error {
+	lien := new(Lien)
+
+	found, err := getCompositeObject(ctx, lienObjectType, []string{carNumber, lienID}, lien)
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("Lien %s on %s does not exist", lienID, carNumber)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if mspID != lien.LenderMSP || clientID != lien.LenderID {
+		return fmt.Errorf("Only the lender may release lien %s", lienID)
+	}
+
+	if lien.LienStatus != lienStatusActive {
+		return fmt.Errorf("Lien %s on %s is already released", lienID, carNumber)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	lien.LienStatus = lienStatusReleased
+	lien.ReleasedAt = now.Format(time.RFC3339)
+
+	return putCompositeObject(ctx, lienObjectType, []string{carNumber, lienID}, lien)
+}
+
+// QueryLiensByCar returns every lien, active or released, registered on the car with given id
+func (s *SmartContract) QueryLiensByCar(ctx contractapi.TransactionContextInterface, carNumber string) ([]Lien, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(lienObjectType, []string{carNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructLiens(resultsIterator)
+}
+
+// QueryLiensByLender returns every lien, active or released, registered by the given lender identity
+func (s *SmartContract) QueryLiensByLender(ctx contractapi.TransactionContextInterface, lenderMSP string, lenderID string) ([]Lien, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(lienLenderIndexName, []string{lenderMSP, lenderID})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	liens := []Lien{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to split index key. %s", err.Error())
+		}
+
+		carNumber, lienID := keyParts[2], keyParts[3]
+		lien := Lien{}
+
+		found, err := getCompositeObject(ctx, lienObjectType, []string{carNumber, lienID}, &lien)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			liens = append(liens, lien)
+		}
+	}
+
+	return liens, nil
+}
+
+// assertNoActiveLien returns an error if an active lien is registered on the car
+func assertNoActiveLien(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(lienObjectType, []string{carNumber})
+
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	liens, err := constructLiens(resultsIterator)
+
+	if err != nil {
+		return err
+	}
+
+	for _, lien := range liens {
+		if lien.LienStatus == lienStatusActive {
+			return fmt.Errorf("%s has an active lien %s held by %s", carNumber, lien.LienID, lien.LenderMSP)
+		}
+	}
+
+	return nil
+}
+
+// constructLiens reads every lien from the iterator
+func constructLiens(resultsIterator shim.StateQueryIteratorInterface) ([]Lien, error) {
+	liens := []Lien{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		lien := Lien{}
+
+		if err := json.Unmarshal(queryResponse.Value, &lien); err != nil {
+			return nil, fmt.Errorf("Failed to decode lien. %s", err.Error())
+		}
+
+		liens = append(liens, lien)
+	}
+
+	return liens, nil
+}
+
+// containsString reports whether value is one of values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
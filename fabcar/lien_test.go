@@ -0,0 +1,127 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// registerLien registers a lien of the lender in USD on the car and returns its id
+func (f *fabcarTest) registerLien(lender *testClient, carNumber string, amount int64) string {
+	f.t.Helper()
+
+	var lienID string
+
+	assertNoError(f.t, f.submit(lender, func(ctx contractapi.TransactionContextInterface) (err error) {
+		lienID, err = f.contract.RegisterLien(ctx, carNumber, amount, "USD")
+		return err
+	}))
+
+	return lienID
+}
+
+func TestRegisterLien(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.RegisterLien(ctx, "CAR10", 50000, "USD")
+		return err
+	})
+	assertErrorContains(t, err, "Submitting client is not a member of a lender organisation")
+
+	err = f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.RegisterLien(ctx, "CAR10", 0, "USD")
+		return err
+	})
+	assertErrorContains(t, err, "Lien amount must be greater than zero")
+
+	err = f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.RegisterLien(ctx, "CAR10", 50000, "XXX")
+		return err
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+
+	lienID := f.registerLien(f.bank, "CAR10", 50000)
+
+	var liens []Lien
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		liens, err = f.contract.QueryLiensByCar(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, liens, []Lien{{
+		LienID:       lienID,
+		CarNumber:    "CAR10",
+		LenderMSP:    f.bank.MSPID,
+		LenderID:     f.bank.ID,
+		Amount:       Money{Amount: 50000, Currency: "USD"},
+		LienStatus:   lienStatusActive,
+		RegisteredAt: "2021-01-01T00:00:05Z",
+	}})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "CAR10 has an active lien "+lienID)
+	assertEqual(t, f.queryCar("CAR10").OwnerID, f.alice.ID)
+}
+
+func TestReleaseLien(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	lienID := f.registerLien(f.bank, "CAR10", 50000)
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", lienID)
+	})
+	assertErrorContains(t, err, "Only the lender may release lien "+lienID)
+
+	assertNoError(t, f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", lienID)
+	}))
+
+	err = f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", lienID)
+	})
+	assertErrorContains(t, err, "is already released")
+
+	err = f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", "tx9999")
+	})
+	assertErrorContains(t, err, "Lien tx9999 on CAR10 does not exist")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	}))
+}
+
+func TestQueryLiensByLender(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.createCar(f.alice, "CAR11")
+	first := f.registerLien(f.bank, "CAR10", 50000)
+	second := f.registerLien(f.bank, "CAR11", 20000)
+	f.registerLien(f.bob, "CAR11", 10000)
+
+	assertNoError(t, f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReleaseLien(ctx, "CAR10", first)
+	}))
+
+	var liens []Lien
+
+	assertNoError(t, f.evaluate(f.bank, func(ctx contractapi.TransactionContextInterface) (err error) {
+		liens, err = f.contract.QueryLiensByLender(ctx, f.bank.MSPID, f.bank.ID)
+		return err
+	}))
+	assertEqual(t, len(liens), 2)
+	assertEqual(t, liens[0].LienID, first)
+	assertEqual(t, liens[0].LienStatus, lienStatusReleased)
+	assertEqual(t, liens[0].ReleasedAt, "2021-01-01T00:00:06Z")
+	assertEqual(t, liens[1].LienID, second)
+	assertEqual(t, liens[1].LienStatus, lienStatusActive)
+}
@@ -0,0 +1,160 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CarStatus is the lifecycle state of a car
+type CarStatus string
+
+// Lifecycle states of a car. Cars written before the lifecycle was tracked
+// have no status and are treated as Registered
+const (
+	StatusRegistered CarStatus = "Registered"
+	StatusForSale    CarStatus = "ForSale"
+	StatusSold       CarStatus = "Sold"
+	StatusStolen     CarStatus = "Stolen"
+	StatusScrapped   CarStatus = "Scrapped"
+)
+
+// carStatusTransitions lists the states each state may move to. Scrapped is
+// terminal and a stolen car can only be recovered. A sold car is Registered
+// again when its new owner transfers it with ChangeCarOwner
+var carStatusTransitions = map[CarStatus][]CarStatus{
+	StatusRegistered: {StatusForSale, StatusStolen, StatusScrapped},
+	StatusForSale:    {StatusRegistered, StatusSold, StatusStolen, StatusScrapped},
+	StatusSold:       {StatusRegistered, StatusForSale, StatusStolen, StatusScrapped},
+	StatusStolen:     {StatusRegistered},
+	StatusScrapped:   {},
+}
+
+// ReportCarStolen marks the car with given id Stolen and withdraws it from
+// sale or auction. Only clients of the authority organisation may report a
+// car stolen
+func (s *SmartContract) ReportCarStolen(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := assertAuthority(ctx); err != nil {
+		return err
+	}
+
+	return s.changeCarStatus(ctx, carNumber, StatusStolen)
+}
+
+// ReportCarRecovered marks a stolen car with given id Registered again. Only
+// clients of the authority organisation may report a car recovered
+func (s *SmartContract) ReportCarRecovered(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := assertAuthority(ctx); err != nil {
+		return err
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if currentCarStatus(car) != StatusStolen {
+		return fmt.Errorf("%s is not reported stolen", carNumber)
+	}
+
+	return s.changeCarStatus(ctx, carNumber, StatusRegistered)
+}
+
+// ScrapCar marks the car with given id Scrapped, after which it can no longer
+// change hands or price. Only the owner may scrap a car
+func (s *SmartContract) ScrapCar(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return s.changeCarStatus(ctx, carNumber, StatusScrapped)
+}
+
+// changeCarStatus moves the car to the given state, clearing any sale and
+// cancelling an open auction, and emits a StatusChanged event
+func (s *SmartContract) changeCarStatus(ctx contractapi.TransactionContextInterface, carNumber string, status CarStatus) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	before := *car
+
+	if err := transitionCarStatus(carNumber, car, status); err != nil {
+		return err
+	}
+
+	if err := clearSale(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := cancelOpenAuction(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, statusChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// currentCarStatus returns the status of the car, treating a missing status as Registered
+func currentCarStatus(car *Car) CarStatus {
+	if car.Status == "" {
+		return StatusRegistered
+	}
+
+	return car.Status
+}
+
+// transitionCarStatus sets the status of the car if its current state may move to status
+func transitionCarStatus(carNumber string, car *Car, status CarStatus) error {
+	current := currentCarStatus(car)
+
+	for _, allowed := range carStatusTransitions[current] {
+		if allowed == status {
+			car.Status = status
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s cannot move from %s to %s", carNumber, current, status)
+}
+
+// assertCarActive returns an error if the car is stolen or scrapped
+func assertCarActive(carNumber string, car *Car) error {
+	switch status := currentCarStatus(car); status {
+	case StatusStolen, StatusScrapped:
+		return fmt.Errorf("%s is %s", carNumber, status)
+	}
+
+	return nil
+}
+
+// assertAuthority returns an error unless the submitting client belongs to the authority organisation
+func assertAuthority(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	if mspID != authorityMSPID {
+		return fmt.Errorf("Submitting client is not a member of %s", authorityMSPID)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestReportCarStolen(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Submitting client is not a member of "+authorityMSPID)
+
+	assertNoError(t, f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR10")
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusStolen)
+	assertEqual(t, f.lastCarEvent().Type, statusChangedEvent)
+
+	err = f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QuerySaleListing(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "CAR10 is not listed for sale")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "CAR10 is Stolen")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", 90000, "USD")
+	})
+	assertErrorContains(t, err, "CAR10 cannot move from Stolen to ForSale")
+}
+
+func TestReportCarRecovered(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarRecovered(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "CAR10 is not reported stolen")
+
+	assertNoError(t, f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR10")
+	}))
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarRecovered(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Submitting client is not a member of "+authorityMSPID)
+
+	assertNoError(t, f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarRecovered(ctx, "CAR10")
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusRegistered)
+}
+
+func TestScrapCar(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ScrapCar(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ScrapCar(ctx, "CAR10")
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusScrapped)
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", 1, "USD")
+	})
+	assertErrorContains(t, err, "CAR10 is Scrapped")
+
+	err = f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "CAR10 cannot move from Scrapped to Stolen")
+}
+
+func TestChangeCarOwnerOfSoldCar(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+	offerID := f.makeOffer(f.bob, "CAR10", 80000)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusSold)
+
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarOwner(ctx, "CAR10", "Alice", f.alice.MSPID, f.alice.ID)
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Status, StatusRegistered)
+	assertEqual(t, car.OwnerID, f.alice.ID)
+}
+
+func TestLegacyCarIsRegistered(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.stub.MockTransactionStart("legacy")
+	assertNoError(t, f.stub.MockStub.PutState("CAR0", []byte(`{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","price":10000}`)))
+	f.stub.MockTransactionEnd("legacy")
+
+	assertEqual(t, f.queryCar("CAR0").Status, StatusRegistered)
+
+	assertNoError(t, f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ReportCarStolen(ctx, "CAR0")
+	}))
+	assertEqual(t, f.queryCar("CAR0").Status, StatusStolen)
+}
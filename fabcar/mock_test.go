@@ -0,0 +1,756 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+// This file holds the harness the contract tests run against, no peer is
+// needed. Transactions run against testStub, an in-memory ledger built on
+// shimtest.MockStub, through a contractapi.TransactionContext whose client
+// identity is read from a generated X.509 certificate. It depends on nothing
+// but the shim and the Fabric protos, so it can be copied next to the tests of
+// another chaincode as is.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testStub behaves like a peer where shimtest.MockStub does not. Writes are
+// buffered until the transaction commits, so reads never see writes of their
+// own transaction and failed transactions leave the ledger untouched, and only
+// the last event of a transaction is kept. Range queries skip composite keys.
+// Pagination, rich queries with CouchDB selectors, key history, transient data
+// and private data hashes are supported
+type testStub struct {
+	*shimtest.MockStub
+	transient     map[string][]byte
+	writes        map[string][]byte
+	privateWrites map[string]map[string][]byte
+	policies      map[string][]byte
+	event         *peer.ChaincodeEvent
+	history       map[string][]*queryresult.KeyModification
+}
+
+func newTestStub(name string) *testStub {
+	stub := &testStub{
+		MockStub: shimtest.NewMockStub(name, nil),
+		history:  map[string][]*queryresult.KeyModification{},
+	}
+	stub.reset()
+
+	return stub
+}
+
+// reset discards the buffered writes, event and transient data of a transaction
+func (s *testStub) reset() {
+	s.transient = map[string][]byte{}
+	s.writes = map[string][]byte{}
+	s.privateWrites = map[string]map[string][]byte{}
+	s.policies = map[string][]byte{}
+	s.event = nil
+}
+
+// commit applies the buffered writes of the transaction to the ledger
+func (s *testStub) commit() error {
+	keys := make([]string, 0, len(s.writes))
+
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := s.writes[key]
+
+		if err := s.MockStub.PutState(key, value); err != nil {
+			return err
+		}
+
+		// deleting a key also removes its key-level endorsement policy
+		if value == nil {
+			delete(s.EndorsementPolicies[""], key)
+		}
+
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{
+			TxId:      s.TxID,
+			Value:     value,
+			Timestamp: s.TxTimestamp,
+			IsDelete:  value == nil,
+		})
+	}
+
+	for collection, writes := range s.privateWrites {
+		if s.PvtState[collection] == nil {
+			s.PvtState[collection] = map[string][]byte{}
+		}
+
+		for key, value := range writes {
+			if value == nil {
+				delete(s.PvtState[collection], key)
+			} else {
+				s.PvtState[collection][key] = value
+			}
+		}
+	}
+
+	for key, policy := range s.policies {
+		if err := s.MockStub.SetStateValidationParameter(key, policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PutState buffers the write until the transaction commits
+func (s *testStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+
+	if len(value) == 0 {
+		return s.DelState(key)
+	}
+
+	s.writes[key] = append([]byte{}, value...)
+
+	return nil
+}
+
+// DelState buffers the deletion until the transaction commits
+func (s *testStub) DelState(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+
+	s.writes[key] = nil
+
+	return nil
+}
+
+// PutPrivateData buffers the write until the transaction commits
+func (s *testStub) PutPrivateData(collection string, key string, value []byte) error {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = map[string][]byte{}
+	}
+
+	s.privateWrites[collection][key] = append([]byte{}, value...)
+
+	return nil
+}
+
+// DelPrivateData buffers the deletion until the transaction commits
+func (s *testStub) DelPrivateData(collection string, key string) error {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = map[string][]byte{}
+	}
+
+	s.privateWrites[collection][key] = nil
+
+	return nil
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of the committed private data, as peers
+// outside the collection see it
+func (s *testStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := s.PvtState[collection][key]
+
+	if value == nil {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256(value)
+
+	return hash[:], nil
+}
+
+// SetStateValidationParameter buffers the policy until the transaction commits
+func (s *testStub) SetStateValidationParameter(key string, policy []byte) error {
+	s.policies[key] = policy
+
+	return nil
+}
+
+// SetEvent keeps the event, replacing any earlier event of the transaction
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name must not be empty")
+	}
+
+	s.event = &peer.ChaincodeEvent{EventName: name, Payload: payload}
+
+	return nil
+}
+
+// GetTransient returns the transient data set for the transaction
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// GetStateByRange returns the committed simple keys in [startKey, endKey)
+func (s *testStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	results, err := s.rangeResults(startKey, endKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &testStateIterator{results: results}, nil
+}
+
+// GetStateByRangeWithPagination returns a page of the committed simple keys in
+// [startKey, endKey). The bookmark is the key the next page starts at
+func (s *testStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	results, err := s.rangeResults(startKey, endKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return paginate(results, pageSize, bookmark)
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns a page of the committed
+// composite keys with the given prefix
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	iterator, err := s.MockStub.GetStateByPartialCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iterator.Close()
+
+	results := []*queryresult.KV{}
+
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return paginate(results, pageSize, bookmark)
+}
+
+// GetQueryResult runs a CouchDB query over the committed JSON values. Only the
+// selector is evaluated and results are in key order
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	results, err := s.queryResults(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &testStateIterator{results: results}, nil
+}
+
+// GetQueryResultWithPagination returns a page of the results of a CouchDB query
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	results, err := s.queryResults(query)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return paginate(results, pageSize, bookmark)
+}
+
+// GetHistoryForKey returns every committed modification of the key, oldest first
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &testHistoryIterator{results: s.history[key]}, nil
+}
+
+// rangeResults returns the committed simple keys in [startKey, endKey) in key order
+func (s *testStub) rangeResults(startKey string, endKey string) ([]*queryresult.KV, error) {
+	for _, key := range []string{startKey, endKey} {
+		if strings.HasPrefix(key, "\x00") {
+			return nil, fmt.Errorf("range query key %q is a composite key", key)
+		}
+	}
+
+	results := []*queryresult.KV{}
+
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+
+		if strings.HasPrefix(key, "\x00") || key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+
+		results = append(results, &queryresult.KV{Key: key, Value: s.State[key]})
+	}
+
+	return results, nil
+}
+
+// queryResults returns the committed keys whose JSON value matches the query
+// selector. Like CouchDB it looks at composite keys too, so a selector that
+// also matches other objects than the intended ones is caught
+func (s *testStub) queryResults(query string) ([]*queryresult.KV, error) {
+	parsed := struct {
+		Selector map[string]interface{} `json:"selector"`
+	}{}
+
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid query %s: %s", query, err.Error())
+	}
+
+	results := []*queryresult.KV{}
+
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+		document := map[string]interface{}{}
+
+		if err := json.Unmarshal(s.State[key], &document); err != nil {
+			continue
+		}
+
+		if matchesSelector(document, parsed.Selector) {
+			results = append(results, &queryresult.KV{Key: key, Value: s.State[key]})
+		}
+	}
+
+	return results, nil
+}
+
+// paginate returns the page of at most pageSize results starting at the bookmark key
+func paginate(results []*queryresult.KV, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	start := 0
+
+	if bookmark != "" {
+		start = sort.Search(len(results), func(i int) bool { return results[i].Key >= bookmark })
+	}
+
+	end := start + int(pageSize)
+
+	if end > len(results) {
+		end = len(results)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+
+	if end < len(results) {
+		metadata.Bookmark = results[end].Key
+	}
+
+	return &testStateIterator{results: results[start:end]}, metadata, nil
+}
+
+// matchesSelector evaluates the subset of CouchDB selectors the contracts use:
+// fields given as dotted paths compared for equality or with $eq, $ne, $gt,
+// $gte, $lt, $lte, $in, $exists and $regex, combined with $and and $or
+func matchesSelector(document map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		switch field {
+		case "$and", "$or":
+			clauses, _ := condition.([]interface{})
+			matched := 0
+
+			for _, clause := range clauses {
+				if clauseSelector, ok := clause.(map[string]interface{}); ok && matchesSelector(document, clauseSelector) {
+					matched++
+				}
+			}
+
+			if (field == "$and" && matched != len(clauses)) || (field == "$or" && matched == 0) {
+				return false
+			}
+
+			continue
+		}
+
+		value, found := lookupField(document, field)
+		operators, ok := condition.(map[string]interface{})
+
+		if !ok || !isOperatorMap(operators) {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+
+		for operator, operand := range operators {
+			if !matchesOperator(operator, value, found, operand) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isOperatorMap reports whether every key of the condition is an operator
+func isOperatorMap(condition map[string]interface{}) bool {
+	for key := range condition {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+
+	return len(condition) > 0
+}
+
+// matchesOperator evaluates a single selector operator against a field value
+func matchesOperator(operator string, value interface{}, found bool, operand interface{}) bool {
+	switch operator {
+	case "$exists":
+		return found == (operand == true)
+	case "$ne":
+		return !found || !reflect.DeepEqual(value, operand)
+	}
+
+	if !found {
+		return false
+	}
+
+	switch operator {
+	case "$eq":
+		return reflect.DeepEqual(value, operand)
+	case "$in":
+		candidates, _ := operand.([]interface{})
+
+		for _, candidate := range candidates {
+			if reflect.DeepEqual(value, candidate) {
+				return true
+			}
+		}
+
+		return false
+	case "$regex":
+		pattern, _ := operand.(string)
+		text, ok := value.(string)
+		matched, err := regexp.MatchString(pattern, text)
+
+		return ok && err == nil && matched
+	}
+
+	comparison, ok := compareValues(value, operand)
+
+	if !ok {
+		return false
+	}
+
+	switch operator {
+	case "$gt":
+		return comparison > 0
+	case "$gte":
+		return comparison >= 0
+	case "$lt":
+		return comparison < 0
+	case "$lte":
+		return comparison <= 0
+	}
+
+	return false
+}
+
+// compareValues orders two numbers or two strings
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+
+		return 0, true
+	case string:
+		b, ok := b.(string)
+
+		return strings.Compare(a, b), ok
+	}
+
+	return 0, false
+}
+
+// lookupField returns the value at a dotted path of the document
+func lookupField(document map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = document
+
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[part]
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// testStateIterator iterates over a fixed list of key values
+type testStateIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (i *testStateIterator) HasNext() bool {
+	return i.next < len(i.results)
+}
+
+func (i *testStateIterator) Next() (*queryresult.KV, error) {
+	if !i.HasNext() {
+		return nil, fmt.Errorf("iterator is exhausted")
+	}
+
+	i.next++
+
+	return i.results[i.next-1], nil
+}
+
+func (i *testStateIterator) Close() error {
+	return nil
+}
+
+// testHistoryIterator iterates over a fixed list of key modifications
+type testHistoryIterator struct {
+	results []*queryresult.KeyModification
+	next    int
+}
+
+func (i *testHistoryIterator) HasNext() bool {
+	return i.next < len(i.results)
+}
+
+func (i *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if !i.HasNext() {
+		return nil, fmt.Errorf("iterator is exhausted")
+	}
+
+	i.next++
+
+	return i.results[i.next-1], nil
+}
+
+func (i *testHistoryIterator) Close() error {
+	return nil
+}
+
+// testClient is a client identity transactions are submitted as
+type testClient struct {
+	MSPID   string
+	ID      string
+	creator []byte
+}
+
+// newTestClient generates a self-signed certificate with the given common
+// name and organisational units for a member of mspID
+func newTestClient(t *testing.T, mspID string, commonName string, organizationalUnits ...string) *testClient {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: organizationalUnits},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to marshal identity: %v", err)
+	}
+
+	stub := shimtest.NewMockStub("identity", nil)
+	stub.Creator = creator
+	identity, err := cid.New(stub)
+
+	if err != nil {
+		t.Fatalf("failed to read identity: %v", err)
+	}
+
+	id, err := identity.GetID()
+
+	if err != nil {
+		t.Fatalf("failed to read client ID: %v", err)
+	}
+
+	return &testClient{MSPID: mspID, ID: id, creator: creator}
+}
+
+// testNetwork submits transactions to a testStub with a controllable clock
+type testNetwork struct {
+	t         *testing.T
+	stub      *testStub
+	clock     time.Time
+	txCount   int
+	lastEvent *peer.ChaincodeEvent
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	return &testNetwork{
+		t:     t,
+		stub:  newTestStub("test"),
+		clock: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// submit runs fn as a transaction of the client and commits its writes if fn
+// succeeds. The clock moves on by a second with every transaction
+func (n *testNetwork) submit(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	n.t.Helper()
+
+	return n.run(client, fn, true)
+}
+
+// evaluate runs fn as a transaction of the client without committing its
+// writes, like a query sent to a single peer
+func (n *testNetwork) evaluate(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	n.t.Helper()
+
+	return n.run(client, fn, false)
+}
+
+// withTransient sets the transient data of the next transaction
+func (n *testNetwork) withTransient(transient map[string][]byte) *testNetwork {
+	n.stub.transient = transient
+
+	return n
+}
+
+// advance moves the clock forward
+func (n *testNetwork) advance(d time.Duration) {
+	n.clock = n.clock.Add(d)
+}
+
+// setPeerMSP sets the organisation of the endorsing peer for the rest of the test
+func (n *testNetwork) setPeerMSP(mspID string) {
+	previous, set := os.LookupEnv("CORE_PEER_LOCALMSPID")
+	os.Setenv("CORE_PEER_LOCALMSPID", mspID)
+
+	n.t.Cleanup(func() {
+		if set {
+			os.Setenv("CORE_PEER_LOCALMSPID", previous)
+		} else {
+			os.Unsetenv("CORE_PEER_LOCALMSPID")
+		}
+	})
+}
+
+func (n *testNetwork) run(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error, commit bool) error {
+	n.t.Helper()
+
+	n.txCount++
+	n.clock = n.clock.Add(time.Second)
+	txID := fmt.Sprintf("tx%04d", n.txCount)
+
+	stub := n.stub
+	stub.MockTransactionStart(txID)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: n.clock.Unix(), Nanos: int32(n.clock.Nanosecond())}
+	stub.Creator = client.creator
+
+	defer func() {
+		stub.MockTransactionEnd(txID)
+		stub.reset()
+	}()
+
+	identity, err := cid.New(stub)
+
+	if err != nil {
+		n.t.Fatalf("failed to read client identity: %v", err)
+	}
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(identity)
+
+	if err := fn(ctx); err != nil {
+		return err
+	}
+
+	if commit {
+		if err := stub.commit(); err != nil {
+			n.t.Fatalf("failed to commit %s: %v", txID, err)
+		}
+
+		n.lastEvent = stub.event
+	}
+
+	return nil
+}
+
+// assertNoError fails the test if err is not nil
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// assertErrorContains fails the test unless err contains substring
+func assertErrorContains(t *testing.T, err error, substring string) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected error containing %q, got nil", substring)
+	}
+
+	if !strings.Contains(err.Error(), substring) {
+		t.Fatalf("expected error containing %q, got %q", substring, err.Error())
+	}
+}
+
+// assertEqual fails the test unless got and want are deeply equal
+func assertEqual(t *testing.T, got interface{}, want interface{}) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// defaultCurrency is the currency of prices stored as plain integers before
+// prices carried a currency. Those prices are read as whole units of it
+const defaultCurrency = "USD"
+
+// priceChangeObjectType is the object type of the composite keys the price
+// history of a car is stored under, ordered by the time of the change
+const priceChangeObjectType = "priceChange~carNumber~changedAt~txID"
+
+// currencyMinorUnits lists the ISO 4217 currencies prices may be given in
+// with the number of digits of their minor unit
+var currencyMinorUnits = map[string]int{
+	"AUD": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"TRY": 2,
+	"USD": 2,
+}
+
+// Money is an amount in the minor unit of an ISO 4217 currency, e.g. cents
+// for USD, so that amounts are exact
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// PriceChange records a price of a car together with the client that set it
+// and the transaction timestamp
+type PriceChange struct {
+	CarNumber    string `json:"carNumber"`
+	NewPrice     Money  `json:"newPrice"`
+	ChangedByMSP string `json:"changedByMSP"`
+	ChangedByID  string `json:"changedByID"`
+	ChangedAt    string `json:"changedAt"`
+	TxID         string `json:"txId"`
+}
+
+// QueryPriceHistory returns every price recorded for the car with given id,
+// oldest first. Prices set before the history was recorded are not included
+func (s *SmartContract) QueryPriceHistory(ctx contractapi.TransactionContextInterface, carNumber string) ([]PriceChange, error) {
+	if _, err := s.QueryCar(ctx, carNumber); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(priceChangeObjectType, []string{carNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	changes := []PriceChange{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		change := PriceChange{}
+
+		if err := json.Unmarshal(queryResponse.Value, &change); err != nil {
+			return nil, fmt.Errorf("Failed to decode price change. %s", err.Error())
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// validateMoney checks that the currency is supported and the amount not negative
+func validateMoney(name string, money Money) error {
+	if _, ok := currencyMinorUnits[money.Currency]; !ok {
+		return newContractError(CodeInvalidArgument, "%s currency %q is not a supported ISO 4217 code", name, money.Currency)
+	}
+
+	if money.Amount < 0 {
+		return newContractError(CodeInvalidArgument, "%s must not be negative", name)
+	}
+
+	return nil
+}
+
+// moneyFromWholeUnits converts an amount in whole units of the currency to Money
+func moneyFromWholeUnits(units int64, currency string) Money {
+	amount := units
+
+	for i := 0; i < currencyMinorUnits[currency]; i++ {
+		amount *= 10
+	}
+
+	return Money{Amount: amount, Currency: currency}
+}
+
+// recordPriceChange adds the current price of the car to its price history on
+// behalf of the submitting client
+func recordPriceChange(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	change := PriceChange{
+		CarNumber:    carNumber,
+		NewPrice:     car.Price,
+		ChangedByMSP: mspID,
+		ChangedByID:  clientID,
+		ChangedAt:    now.Format(time.RFC3339Nano),
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+
+	return putCarObject(ctx, car.OwnerMSP, priceChangeObjectType, []string{carNumber, fmt.Sprintf("%020d", now.UnixNano()), change.TxID}, change)
+}
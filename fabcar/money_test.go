@@ -0,0 +1,59 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestMoneyFromWholeUnits(t *testing.T) {
+	assertEqual(t, moneyFromWholeUnits(12, "USD"), Money{Amount: 1200, Currency: "USD"})
+	assertEqual(t, moneyFromWholeUnits(12, "JPY"), Money{Amount: 12, Currency: "JPY"})
+	assertEqual(t, moneyFromWholeUnits(12, "KWD"), Money{Amount: 12000, Currency: "KWD"})
+}
+
+func TestQueryPriceHistory(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeCarPrice(ctx, "CAR10", 9000000, "JPY")
+	}))
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", 8500000, "JPY")
+	}))
+
+	var offerID string
+
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offerID, err = f.contract.MakeOffer(ctx, "CAR10", "Bob", 8000000, "JPY", 3600)
+		return err
+	}))
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	}))
+
+	var changes []PriceChange
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		changes, err = f.contract.QueryPriceHistory(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, changes, []PriceChange{
+		{CarNumber: "CAR10", NewPrice: Money{Amount: 100000, Currency: "USD"}, ChangedByMSP: f.alice.MSPID, ChangedByID: f.alice.ID, ChangedAt: "2021-01-01T00:00:01Z", TxID: "tx0001"},
+		{CarNumber: "CAR10", NewPrice: Money{Amount: 9000000, Currency: "JPY"}, ChangedByMSP: f.alice.MSPID, ChangedByID: f.alice.ID, ChangedAt: "2021-01-01T00:00:02Z", TxID: "tx0002"},
+		{CarNumber: "CAR10", NewPrice: Money{Amount: 8000000, Currency: "JPY"}, ChangedByMSP: f.alice.MSPID, ChangedByID: f.alice.ID, ChangedAt: "2021-01-01T00:00:05Z", TxID: "tx0005"},
+	})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryPriceHistory(ctx, "CAR404")
+		return err
+	})
+	assertErrorContains(t, err, "CAR404 does not exist")
+}
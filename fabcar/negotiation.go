@@ -0,0 +1,455 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Price negotiations are stored under composite keys in world state. The price
+// each party agrees to is stored under negotiatedPriceObjectType in the private
+// data collection shared by the seller and buyer organisations, so that only
+// its hash is on the public ledger
+const (
+	negotiationObjectType       = "negotiation~carNumber~negotiationID"
+	negotiatedPriceObjectType   = "negotiatedPrice~negotiationID~party"
+	negotiatedPriceTransientKey = "price"
+	negotiationStatusOpen       = "Open"
+	negotiationStatusAgreed     = "Agreed"
+	negotiationStatusCancelled  = "Cancelled"
+	negotiationPartySeller      = "seller"
+	negotiationPartyBuyer       = "buyer"
+)
+
+// PriceNegotiation is the public record of a private price negotiation between
+// the owner of a car and a buyer. Once both agreed to the same price the car is
+// sold and the hash of the price, never the price itself, is recorded
+type PriceNegotiation struct {
+	NegotiationID     string `json:"negotiationID"`
+	CarNumber         string `json:"carNumber"`
+	SellerMSP         string `json:"sellerMSP"`
+	SellerID          string `json:"sellerID"`
+	Buyer             string `json:"buyer"`
+	BuyerMSP          string `json:"buyerMSP"`
+	BuyerID           string `json:"buyerID"`
+	Collection        string `json:"collection"`
+	NegotiationStatus string `json:"negotiationStatus"`
+	PriceHash         string `json:"priceHash,omitempty"`
+	OpenedAt          string `json:"openedAt"`
+	AgreedAt          string `json:"agreedAt,omitempty"`
+}
+
+// NegotiatedPrice is the plaintext of a negotiated price passed in the
+// transient map under the price key. Seller and buyer have to pass the same
+// bytes, as the prices are compared by hash, and the salt keeps the price from
+// being guessed from the hash
+type NegotiatedPrice struct {
+	Price Money  `json:"price"`
+	Salt  string `json:"salt"`
+}
+
+// OpenPriceNegotiation starts a private price negotiation of the owner of the
+// car with given id with a buyer identity. Only the owner may open a
+// negotiation and its id, the transaction id, is returned
+func (s *SmartContract) OpenPriceNegotiation(ctx contractapi.TransactionContextInterface, carNumber string, buyer string, buyerMSP string, buyerID string) (string, error) {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return "", err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return "", err
+	}
+
+	if buyerMSP == "" || buyerID == "" {
+		return "", fmt.Errorf("Buyer MSP ID and client ID must be provided")
+	}
+
+	if buyerMSP == car.OwnerMSP && buyerID == car.OwnerID {
+		return "", fmt.Errorf("Owner cannot negotiate the price of %s with themselves", carNumber)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	negotiation := PriceNegotiation{
+		NegotiationID:     ctx.GetStub().GetTxID(),
+		CarNumber:         carNumber,
+		SellerMSP:         car.OwnerMSP,
+		SellerID:          car.OwnerID,
+		Buyer:             buyer,
+		BuyerMSP:          buyerMSP,
+		BuyerID:           buyerID,
+		Collection:        negotiationCollectionName(car.OwnerMSP, buyerMSP),
+		NegotiationStatus: negotiationStatusOpen,
+		OpenedAt:          now.Format(time.RFC3339),
+	}
+
+	if err := putCarObject(ctx, car.OwnerMSP, negotiationObjectType, []string{carNumber, negotiation.NegotiationID}, negotiation); err != nil {
+		return "", err
+	}
+
+	return negotiation.NegotiationID, nil
+}
+
+// QueryPriceNegotiation returns the negotiation with given id of the car with given id
+func (s *SmartContract) QueryPriceNegotiation(ctx contractapi.TransactionContextInterface, carNumber string, negotiationID string) (*PriceNegotiation, error) {
+	negotiation := new(PriceNegotiation)
+
+	found, err := getCompositeObject(ctx, negotiationObjectType, []string{carNumber, negotiationID}, negotiation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Negotiation %s of %s does not exist", negotiationID, carNumber)
+	}
+
+	return negotiation, nil
+}
+
+// QueryPriceNegotiations returns every negotiation, in any state, of the car with given id
+func (s *SmartContract) QueryPriceNegotiations(ctx contractapi.TransactionContextInterface, carNumber string) ([]PriceNegotiation, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(negotiationObjectType, []string{carNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	negotiations := []PriceNegotiation{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		negotiation := PriceNegotiation{}
+
+		if err := json.Unmarshal(queryResponse.Value, &negotiation); err != nil {
+			return nil, fmt.Errorf("Failed to decode negotiation. %s", err.Error())
+		}
+
+		negotiations = append(negotiations, negotiation)
+	}
+
+	return negotiations, nil
+}
+
+// AgreeToPrice records the price the submitting seller or buyer of an open
+// negotiation agrees to. The NegotiatedPrice is passed in the transient map
+// under the price key and stored in the private data collection of the seller
+// and buyer organisations only. The transaction writes no public state, so it
+// is endorsed under the collection endorsement policy by a peer of the client
+// organisation alone and no other organisation sees the price. Agreeing again
+// replaces the earlier price of the party
+func (s *SmartContract) AgreeToPrice(ctx contractapi.TransactionContextInterface, carNumber string, negotiationID string) error {
+	negotiation, err := s.QueryPriceNegotiation(ctx, carNumber, negotiationID)
+
+	if err != nil {
+		return err
+	}
+
+	if negotiation.NegotiationStatus != negotiationStatusOpen {
+		return fmt.Errorf("Negotiation %s of %s is %s", negotiationID, carNumber, negotiation.NegotiationStatus)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	party, err := negotiationParty(negotiation, mspID, clientID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertPeerOrgMatchesClientOrg(mspID); err != nil {
+		return err
+	}
+
+	priceAsBytes, err := getTransientNegotiatedPrice(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := negotiatedPriceKey(ctx, negotiationID, party)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutPrivateData(negotiation.Collection, privateKey, priceAsBytes); err != nil {
+		return fmt.Errorf("Failed to put price to private data. %s", err.Error())
+	}
+
+	return nil
+}
+
+// SellCarAtNegotiatedPrice sells the car with given id to the buyer of an open
+// negotiation once seller and buyer agreed to the same price, which is checked
+// by comparing the hashes of their private prices. The hash is recorded with
+// the negotiation while the public price of the car is left unchanged. Only
+// the seller may complete the sale, not while the car is being auctioned, and
+// the car is Sold to the buyer
+func (s *SmartContract) SellCarAtNegotiatedPrice(ctx contractapi.TransactionContextInterface, carNumber string, negotiationID string) error {
+	negotiation, err := s.QueryPriceNegotiation(ctx, carNumber, negotiationID)
+
+	if err != nil {
+		return err
+	}
+
+	if negotiation.NegotiationStatus != negotiationStatusOpen {
+		return fmt.Errorf("Negotiation %s of %s is %s", negotiationID, carNumber, negotiation.NegotiationStatus)
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if car.OwnerMSP != negotiation.SellerMSP || car.OwnerID != negotiation.SellerID {
+		return fmt.Errorf("%s changed owner since negotiation %s was opened", carNumber, negotiationID)
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return err
+	}
+
+	if err := assertNoOpenAuction(ctx, carNumber); err != nil {
+		return err
+	}
+
+	sellerHash, err := getNegotiatedPriceHash(ctx, negotiation, negotiationPartySeller)
+
+	if err != nil {
+		return err
+	}
+
+	buyerHash, err := getNegotiatedPriceHash(ctx, negotiation, negotiationPartyBuyer)
+
+	if err != nil {
+		return err
+	}
+
+	if sellerHash == nil || buyerHash == nil {
+		return fmt.Errorf("Seller and buyer have to agree to a price of %s first", carNumber)
+	}
+
+	if !bytes.Equal(sellerHash, buyerHash) {
+		return fmt.Errorf("Seller and buyer agreed to different prices of %s", carNumber)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	before := *car
+
+	// a car that is not listed goes on sale and is sold in the same step
+	if currentCarStatus(car) != StatusForSale {
+		if err := transitionCarStatus(carNumber, car, StatusForSale); err != nil {
+			return err
+		}
+	}
+
+	if err := transitionCarStatus(carNumber, car, StatusSold); err != nil {
+		return err
+	}
+
+	if err := transferCar(ctx, carNumber, car, negotiation.Buyer, negotiation.BuyerMSP, negotiation.BuyerID); err != nil {
+		return err
+	}
+
+	negotiation.NegotiationStatus = negotiationStatusAgreed
+	negotiation.PriceHash = hex.EncodeToString(sellerHash)
+	negotiation.AgreedAt = now.Format(time.RFC3339)
+
+	if err := putCompositeObject(ctx, negotiationObjectType, []string{carNumber, negotiationID}, negotiation); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, carSoldEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// CancelPriceNegotiation ends an open negotiation without a sale. Either the
+// seller or the buyer may cancel it
+func (s *SmartContract) CancelPriceNegotiation(ctx contractapi.TransactionContextInterface, carNumber string, negotiationID string) error {
+	negotiation, err := s.QueryPriceNegotiation(ctx, carNumber, negotiationID)
+
+	if err != nil {
+		return err
+	}
+
+	if negotiation.NegotiationStatus != negotiationStatusOpen {
+		return fmt.Errorf("Negotiation %s of %s is %s", negotiationID, carNumber, negotiation.NegotiationStatus)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := negotiationParty(negotiation, mspID, clientID); err != nil {
+		return err
+	}
+
+	negotiation.NegotiationStatus = negotiationStatusCancelled
+
+	return putCompositeObject(ctx, negotiationObjectType, []string{carNumber, negotiationID}, negotiation)
+}
+
+// VerifyNegotiatedPrice reports whether a claimed price is the price a car was
+// sold at in an agreed negotiation. The claimed NegotiatedPrice is passed in the
+// transient map under the price key and compared with the hash of the private
+// price of the seller, which any organisation can read, so a third party shown
+// the price by the seller or buyer can check it without joining the collection
+func (s *SmartContract) VerifyNegotiatedPrice(ctx contractapi.TransactionContextInterface, carNumber string, negotiationID string) (bool, error) {
+	negotiation, err := s.QueryPriceNegotiation(ctx, carNumber, negotiationID)
+
+	if err != nil {
+		return false, err
+	}
+
+	if negotiation.NegotiationStatus != negotiationStatusAgreed {
+		return false, fmt.Errorf("Negotiation %s of %s is %s", negotiationID, carNumber, negotiation.NegotiationStatus)
+	}
+
+	priceAsBytes, err := getTransientNegotiatedPrice(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	sellerHash, err := getNegotiatedPriceHash(ctx, negotiation, negotiationPartySeller)
+
+	if err != nil {
+		return false, err
+	}
+
+	if sellerHash == nil {
+		return false, fmt.Errorf("Price of negotiation %s is no longer in the private data of %s", negotiationID, negotiation.Collection)
+	}
+
+	claimedHash := hashPrivateData(priceAsBytes)
+
+	return claimedHash == hex.EncodeToString(sellerHash) && claimedHash == negotiation.PriceHash, nil
+}
+
+// negotiationCollectionName returns the name of the private data collection
+// shared by two organisations, which is the same in either order. Within one
+// organisation its own collection is used
+func negotiationCollectionName(mspID string, otherMSPID string) string {
+	if mspID == otherMSPID {
+		return orgCollectionName(mspID)
+	}
+
+	orgs := []string{mspID, otherMSPID}
+	sort.Strings(orgs)
+
+	return "negotiation" + orgs[0] + orgs[1]
+}
+
+// negotiationParty returns whether the client is the seller or the buyer of the negotiation
+func negotiationParty(negotiation *PriceNegotiation, mspID string, clientID string) (string, error) {
+	switch {
+	case mspID == negotiation.SellerMSP && clientID == negotiation.SellerID:
+		return negotiationPartySeller, nil
+	case mspID == negotiation.BuyerMSP && clientID == negotiation.BuyerID:
+		return negotiationPartyBuyer, nil
+	}
+
+	return "", fmt.Errorf("Submitting client is not a party of negotiation %s", negotiation.NegotiationID)
+}
+
+// negotiatedPriceKey returns the private data key of the price a party agreed to
+func negotiatedPriceKey(ctx contractapi.TransactionContextInterface, negotiationID string, party string) (string, error) {
+	privateKey, err := ctx.GetStub().CreateCompositeKey(negotiatedPriceObjectType, []string{negotiationID, party})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	return privateKey, nil
+}
+
+// getNegotiatedPriceHash returns the hash of the private price a party agreed
+// to, or nil if the party has not agreed to a price
+func getNegotiatedPriceHash(ctx contractapi.TransactionContextInterface, negotiation *PriceNegotiation, party string) ([]byte, error) {
+	privateKey, err := negotiatedPriceKey(ctx, negotiation.NegotiationID, party)
+
+	if err != nil {
+		return nil, err
+	}
+
+	priceHash, err := ctx.GetStub().GetPrivateDataHash(negotiation.Collection, privateKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read price hash from private data. %s", err.Error())
+	}
+
+	return priceHash, nil
+}
+
+// getTransientNegotiatedPrice returns the raw NegotiatedPrice passed in the transient map after validating it
+func getTransientNegotiatedPrice(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read transient map. %s", err.Error())
+	}
+
+	priceAsBytes, ok := transientMap[negotiatedPriceTransientKey]
+
+	if !ok {
+		return nil, fmt.Errorf("Price must be passed in the transient map under %q", negotiatedPriceTransientKey)
+	}
+
+	negotiatedPrice := new(NegotiatedPrice)
+
+	if err := json.Unmarshal(priceAsBytes, negotiatedPrice); err != nil {
+		return nil, fmt.Errorf("Failed to decode price. %s", err.Error())
+	}
+
+	if err := validateMoney("negotiated price", negotiatedPrice.Price); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(negotiatedPrice.Salt) == "" {
+		return nil, fmt.Errorf("Price salt must not be empty")
+	}
+
+	return priceAsBytes, nil
+}
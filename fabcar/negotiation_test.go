@@ -0,0 +1,272 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// negotiatedPrice returns the NegotiatedPrice as passed in the transient map
+func negotiatedPrice(t *testing.T, amount int64, salt string) map[string][]byte {
+	t.Helper()
+
+	priceAsBytes, err := json.Marshal(NegotiatedPrice{Price: Money{Amount: amount, Currency: "USD"}, Salt: salt})
+
+	if err != nil {
+		t.Fatalf("failed to encode price: %v", err)
+	}
+
+	return map[string][]byte{negotiatedPriceTransientKey: priceAsBytes}
+}
+
+// openNegotiation opens a negotiation of the owner with bob and returns its id
+func (f *fabcarTest) openNegotiation(owner *testClient, carNumber string) string {
+	f.t.Helper()
+
+	var negotiationID string
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) (err error) {
+		negotiationID, err = f.contract.OpenPriceNegotiation(ctx, carNumber, "Bob", f.bob.MSPID, f.bob.ID)
+		return err
+	}))
+
+	return negotiationID
+}
+
+// agreeToPrice records the price the party agrees to, endorsed by a peer of its organisation
+func (f *fabcarTest) agreeToPrice(party *testClient, carNumber string, negotiationID string, amount int64, salt string) error {
+	f.t.Helper()
+
+	f.setPeerMSP(party.MSPID)
+
+	return f.withTransient(negotiatedPrice(f.t, amount, salt)).submit(party, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AgreeToPrice(ctx, carNumber, negotiationID)
+	})
+}
+
+// verifyPrice checks the claimed price of the negotiation as the client
+func (f *fabcarTest) verifyPrice(client *testClient, carNumber string, negotiationID string, amount int64, salt string) (bool, error) {
+	f.t.Helper()
+
+	var verified bool
+
+	err := f.withTransient(negotiatedPrice(f.t, amount, salt)).evaluate(client, func(ctx contractapi.TransactionContextInterface) (err error) {
+		verified, err = f.contract.VerifyNegotiatedPrice(ctx, carNumber, negotiationID)
+		return err
+	})
+
+	return verified, err
+}
+
+func TestNegotiationCollectionName(t *testing.T) {
+	assertEqual(t, negotiationCollectionName("Org2MSP", "Org1MSP"), "negotiationOrg1MSPOrg2MSP")
+	assertEqual(t, negotiationCollectionName("Org1MSP", "Org2MSP"), "negotiationOrg1MSPOrg2MSP")
+	assertEqual(t, negotiationCollectionName("Org1MSP", "Org1MSP"), "privateOrg1MSP")
+}
+
+func TestOpenPriceNegotiation(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenPriceNegotiation(ctx, "CAR10", "Bob", f.bob.MSPID, f.bob.ID)
+		return err
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.OpenPriceNegotiation(ctx, "CAR10", "Alice", f.alice.MSPID, f.alice.ID)
+		return err
+	})
+	assertErrorContains(t, err, "Owner cannot negotiate the price of CAR10 with themselves")
+
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+
+	var negotiations []PriceNegotiation
+
+	assertNoError(t, f.evaluate(f.police, func(ctx contractapi.TransactionContextInterface) (err error) {
+		negotiations, err = f.contract.QueryPriceNegotiations(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, negotiations, []PriceNegotiation{{
+		NegotiationID:     negotiationID,
+		CarNumber:         "CAR10",
+		SellerMSP:         f.alice.MSPID,
+		SellerID:          f.alice.ID,
+		Buyer:             "Bob",
+		BuyerMSP:          f.bob.MSPID,
+		BuyerID:           f.bob.ID,
+		Collection:        "negotiationOrg1MSPOrg2MSP",
+		NegotiationStatus: negotiationStatusOpen,
+		OpenedAt:          "2021-01-01T00:00:04Z",
+	}})
+}
+
+func TestAgreeToPriceKeepsPricePrivate(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+
+	assertErrorContains(t, f.agreeToPrice(f.police, "CAR10", negotiationID, 7777700, "pepper"), "Submitting client is not a party of negotiation "+negotiationID)
+	assertContractError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, -1, "pepper"), CodeInvalidArgument)
+	assertErrorContains(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, " "), "Price salt must not be empty")
+
+	f.setPeerMSP(f.bob.MSPID)
+	err := f.withTransient(negotiatedPrice(t, 7777700, "pepper")).submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AgreeToPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Client from Org1MSP cannot be endorsed by a peer of Org2MSP")
+
+	publicKeys := len(f.stub.State)
+	assertNoError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, "pepper"))
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7777700, "pepper"))
+	assertEqual(t, len(f.stub.State), publicKeys)
+	assertEqual(t, len(f.stub.PvtState["negotiationOrg1MSPOrg2MSP"]), 2)
+
+	for key, value := range f.stub.State {
+		if bytes.Contains(value, []byte("7777700")) {
+			t.Fatalf("price found in public state under %s", key)
+		}
+	}
+}
+
+func TestSellCarAtNegotiatedPrice(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Seller and buyer have to agree to a price of CAR10 first")
+
+	assertNoError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, "pepper"))
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7000000, "pepper"))
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Seller and buyer agreed to different prices of CAR10")
+
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7777700, "pepper"))
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Status, StatusSold)
+	assertEqual(t, car.OwnerID, f.bob.ID)
+	assertEqual(t, car.Price, Money{Amount: 100000, Currency: "USD"})
+	assertEqual(t, f.lastCarEvent().Type, carSoldEvent)
+
+	var negotiation *PriceNegotiation
+
+	assertNoError(t, f.evaluate(f.police, func(ctx contractapi.TransactionContextInterface) (err error) {
+		negotiation, err = f.contract.QueryPriceNegotiation(ctx, "CAR10", negotiationID)
+		return err
+	}))
+	assertEqual(t, negotiation.NegotiationStatus, negotiationStatusAgreed)
+	assertEqual(t, negotiation.PriceHash, hashPrivateData(negotiatedPrice(t, 7777700, "pepper")[negotiatedPriceTransientKey]))
+
+	assertErrorContains(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 1, "pepper"), "Negotiation "+negotiationID+" of CAR10 is Agreed")
+}
+
+func TestSellCarAtNegotiatedPriceDuringAuction(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+	assertNoError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, "pepper"))
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7777700, "pepper"))
+	f.openAuction(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "CAR10 is being auctioned")
+	assertEqual(t, f.queryCar("CAR10").OwnerID, f.alice.ID)
+}
+
+func TestSellListedCarAtNegotiatedPrice(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+	assertNoError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, "pepper"))
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7777700, "pepper"))
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusSold)
+	assertEqual(t, f.lastCarEvent().Changes[0].Before.Status, StatusForSale)
+
+	err := f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QuerySaleListing(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "CAR10 is not listed for sale")
+}
+
+func TestVerifyNegotiatedPrice(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+	assertNoError(t, f.agreeToPrice(f.alice, "CAR10", negotiationID, 7777700, "pepper"))
+	assertNoError(t, f.agreeToPrice(f.bob, "CAR10", negotiationID, 7777700, "pepper"))
+
+	_, err := f.verifyPrice(f.police, "CAR10", negotiationID, 7777700, "pepper")
+	assertErrorContains(t, err, "Negotiation "+negotiationID+" of CAR10 is Open")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	}))
+
+	verified, err := f.verifyPrice(f.police, "CAR10", negotiationID, 7777700, "pepper")
+	assertNoError(t, err)
+	assertEqual(t, verified, true)
+
+	verified, err = f.verifyPrice(f.police, "CAR10", negotiationID, 7000000, "pepper")
+	assertNoError(t, err)
+	assertEqual(t, verified, false)
+
+	verified, err = f.verifyPrice(f.police, "CAR10", negotiationID, 7777700, "salt")
+	assertNoError(t, err)
+	assertEqual(t, verified, false)
+}
+
+func TestCancelPriceNegotiation(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	negotiationID := f.openNegotiation(f.alice, "CAR10")
+
+	err := f.submit(f.police, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelPriceNegotiation(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Submitting client is not a party of negotiation "+negotiationID)
+
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelPriceNegotiation(ctx, "CAR10", negotiationID)
+	}))
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.SellCarAtNegotiatedPrice(ctx, "CAR10", negotiationID)
+	})
+	assertErrorContains(t, err, "Negotiation "+negotiationID+" of CAR10 is Cancelled")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelPriceNegotiation(ctx, "CAR10", "tx9999")
+	})
+	assertErrorContains(t, err, "Negotiation tx9999 of CAR10 does not exist")
+}
@@ -0,0 +1,174 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Rich queries below require CouchDB as the state database. The indexes they
+// use are packaged under META-INF/statedb/couchdb/indexes and named after them
+
+// QueryCarsByMakeAndModel returns all cars of the given make. When model is
+// not empty only cars of that model are returned
+func (s *SmartContract) QueryCarsByMakeAndModel(ctx contractapi.TransactionContextInterface, make string, model string) ([]QueryResult, error) {
+	queryString, err := buildQueryString(makeAndModelSelector(make, model), "indexMakeModel")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// QueryCarsByMakeAndModelWithPagination returns a page of cars of the given make and optional model
+func (s *SmartContract) QueryCarsByMakeAndModelWithPagination(ctx contractapi.TransactionContextInterface, make string, model string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	queryString, err := buildQueryString(makeAndModelSelector(make, model), "indexMakeModel")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// QueryCarsByColour returns all cars of the given colour
+func (s *SmartContract) QueryCarsByColour(ctx contractapi.TransactionContextInterface, colour string) ([]QueryResult, error) {
+	queryString, err := buildQueryString(map[string]interface{}{"colour": colour}, "indexColour")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// QueryCarsByColourWithPagination returns a page of cars of the given colour
+func (s *SmartContract) QueryCarsByColourWithPagination(ctx contractapi.TransactionContextInterface, colour string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	queryString, err := buildQueryString(map[string]interface{}{"colour": colour}, "indexColour")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// QueryCarsByPriceRange returns all cars priced in currency between minPrice
+// and maxPrice inclusive, given in its minor unit. Cars stored before prices
+// carried a currency only match once migrated with MigrateCars
+func (s *SmartContract) QueryCarsByPriceRange(ctx contractapi.TransactionContextInterface, currency string, minPrice int64, maxPrice int64) ([]QueryResult, error) {
+	selector, err := priceRangeSelector(currency, minPrice, maxPrice)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryString, err := buildQueryString(selector, "indexPrice")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+// QueryCarsByPriceRangeWithPagination returns a page of cars priced in currency between minPrice and maxPrice inclusive
+func (s *SmartContract) QueryCarsByPriceRangeWithPagination(ctx contractapi.TransactionContextInterface, currency string, minPrice int64, maxPrice int64, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	selector, err := priceRangeSelector(currency, minPrice, maxPrice)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryString, err := buildQueryString(selector, "indexPrice")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// makeAndModelSelector builds the selector for cars of a make and optional model
+func makeAndModelSelector(make string, model string) map[string]interface{} {
+	selector := map[string]interface{}{"make": make}
+
+	if model != "" {
+		selector["model"] = model
+	}
+
+	return selector
+}
+
+// priceRangeSelector builds the selector for cars priced in a currency within an inclusive range
+func priceRangeSelector(currency string, minPrice int64, maxPrice int64) (map[string]interface{}, error) {
+	if minPrice > maxPrice {
+		return nil, fmt.Errorf("Minimum price %d is greater than maximum price %d", minPrice, maxPrice)
+	}
+
+	return map[string]interface{}{
+		"price.currency": currency,
+		"price.amount":   map[string]int64{"$gte": minPrice, "$lte": maxPrice},
+	}, nil
+}
+
+// buildQueryString marshals a CouchDB selector into a query string using the
+// named index, so values supplied by clients cannot alter the query structure
+func buildQueryString(selector map[string]interface{}, index string) (string, error) {
+	query := map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"_design/" + index + "Doc", index},
+	}
+
+	queryAsBytes, err := json.Marshal(query)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to build query. %s", err.Error())
+	}
+
+	return string(queryAsBytes), nil
+}
+
+// getQueryResultForQueryString runs a rich query and returns every matching car
+func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]QueryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructQueryResults(resultsIterator)
+}
+
+// getQueryResultForQueryStringWithPagination runs a rich query and returns one page of matching cars
+func getQueryResultForQueryStringWithPagination(ctx contractapi.TransactionContextInterface, queryString string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results, err := constructQueryResults(resultsIterator)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             results,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
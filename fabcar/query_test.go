@@ -0,0 +1,122 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// resultKeys returns the keys of the query results in order
+func resultKeys(results []QueryResult) []string {
+	keys := []string{}
+
+	for _, result := range results {
+		keys = append(keys, result.Key)
+	}
+
+	return keys
+}
+
+func TestQueryCarsByMakeAndModel(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByMakeAndModel(ctx, "Volkswagen", "")
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"CAR10", "CAR3"})
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByMakeAndModel(ctx, "Volkswagen", "Polo")
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"CAR10"})
+	assertEqual(t, results[0].Record.OwnerID, f.alice.ID)
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByMakeAndModel(ctx, `Volkswagen", "model": {"$ne": ""`, "")
+		return err
+	}))
+	assertEqual(t, results, []QueryResult{})
+}
+
+func TestQueryCarsByColour(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByColour(ctx, "white")
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"CAR10", "CAR6"})
+
+	var page *PaginatedQueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.QueryCarsByColourWithPagination(ctx, "white", 1, "")
+		return err
+	}))
+	assertEqual(t, resultKeys(page.Records), []string{"CAR10"})
+	assertEqual(t, page.FetchedRecordsCount, int32(1))
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.QueryCarsByColourWithPagination(ctx, "white", 1, page.Bookmark)
+		return err
+	}))
+	assertEqual(t, resultKeys(page.Records), []string{"CAR6"})
+	assertEqual(t, page.Bookmark, "")
+}
+
+func TestQueryCarsByPriceRange(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+
+	assertNoError(t, f.submit(f.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CreateCar(ctx, "CAR10", testVIN(10), "Renault", "Clio", "grey", "Alice", 800000, "EUR")
+	}))
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByPriceRange(ctx, "USD", 800000, 1500000)
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"CAR0", "CAR2", "CAR3", "CAR5", "CAR9"})
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryCarsByPriceRange(ctx, "EUR", 0, 800000)
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"CAR10"})
+
+	var page *PaginatedQueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.QueryCarsByPriceRangeWithPagination(ctx, "USD", 0, 1000000, 2, "")
+		return err
+	}))
+	assertEqual(t, resultKeys(page.Records), []string{"CAR0", "CAR2"})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCarsByPriceRange(ctx, "USD", 2, 1)
+		return err
+	})
+	assertErrorContains(t, err, "Minimum price 2 is greater than maximum price 1")
+
+	err = f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryCarsByMakeAndModelWithPagination(ctx, "Ford", "", 0, "")
+		return err
+	})
+	assertErrorContains(t, err, "Page size must be greater than zero")
+}
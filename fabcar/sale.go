@@ -0,0 +1,371 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Sale listings and offers are stored under composite keys so they are not
+// returned by QueryAllCars. Field names avoid those of Car so the CouchDB
+// selectors used by the rich queries only ever match cars
+const (
+	saleListingObjectType = "sale~carNumber"
+	saleOfferObjectType   = "offer~carNumber~offerID"
+)
+
+// SaleListing describes a car put up for sale by its owner. Offers must be
+// made in the currency of the asking price
+type SaleListing struct {
+	CarNumber   string `json:"carNumber"`
+	SellerMSP   string `json:"sellerMSP"`
+	SellerID    string `json:"sellerID"`
+	AskingPrice Money  `json:"askingPrice"`
+	ListedAt    string `json:"listedAt"`
+}
+
+// SaleOffer describes an offer made by a buyer for a listed car
+type SaleOffer struct {
+	OfferID   string `json:"offerID"`
+	CarNumber string `json:"carNumber"`
+	Buyer     string `json:"buyer"`
+	BuyerMSP  string `json:"buyerMSP"`
+	BuyerID   string `json:"buyerID"`
+	Amount    Money  `json:"amount"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// ListCarForSale puts the car with given id up for sale at the asking price,
+// in the minor unit of the ISO 4217 currency, and marks it ForSale. Only the
+// owner may list a car and listing again replaces the asking price
+func (s *SmartContract) ListCarForSale(ctx contractapi.TransactionContextInterface, carNumber string, askingPrice int64, currency string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	price := Money{Amount: askingPrice, Currency: currency}
+
+	if err := validateMoney("asking price", price); err != nil {
+		return err
+	}
+
+	if err := assertNoOpenAuction(ctx, carNumber); err != nil {
+		return err
+	}
+
+	before := *car
+
+	if car.Status != StatusForSale {
+		if err := transitionCarStatus(carNumber, car, StatusForSale); err != nil {
+			return err
+		}
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	listing := SaleListing{
+		CarNumber:   carNumber,
+		SellerMSP:   car.OwnerMSP,
+		SellerID:    car.OwnerID,
+		AskingPrice: price,
+		ListedAt:    now.Format(time.RFC3339),
+	}
+
+	if err := putCarObject(ctx, car.OwnerMSP, saleListingObjectType, []string{carNumber}, listing); err != nil {
+		return err
+	}
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, statusChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// DelistCar withdraws the car with given id from sale together with all offers
+// made for it and marks it Registered again
+func (s *SmartContract) DelistCar(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if _, err := s.QuerySaleListing(ctx, carNumber); err != nil {
+		return err
+	}
+
+	before := *car
+
+	if err := transitionCarStatus(carNumber, car, StatusRegistered); err != nil {
+		return err
+	}
+
+	if err := clearSale(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, statusChangedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// QuerySaleListing returns the sale listing of the car with given id
+func (s *SmartContract) QuerySaleListing(ctx contractapi.TransactionContextInterface, carNumber string) (*SaleListing, error) {
+	listing := new(SaleListing)
+
+	found, err := getCompositeObject(ctx, saleListingObjectType, []string{carNumber}, listing)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s is not listed for sale", carNumber)
+	}
+
+	return listing, nil
+}
+
+// MakeOffer records an offer of amount for a listed car on behalf of the
+// submitting client. The amount is in the minor unit of the currency, which
+// must be that of the asking price. The offer expires validitySeconds after
+// the transaction timestamp and its id, the transaction id, is returned
+func (s *SmartContract) MakeOffer(ctx contractapi.TransactionContextInterface, carNumber string, buyer string, amount int64, currency string, validitySeconds int) (string, error) {
+	listing, err := s.QuerySaleListing(ctx, carNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	offerAmount := Money{Amount: amount, Currency: currency}
+
+	if err := validateMoney("offer amount", offerAmount); err != nil {
+		return "", err
+	}
+
+	if currency != listing.AskingPrice.Currency {
+		return "", fmt.Errorf("Offers for %s must be made in %s", carNumber, listing.AskingPrice.Currency)
+	}
+
+	if validitySeconds <= 0 {
+		return "", fmt.Errorf("Offer validity must be greater than zero")
+	}
+
+	buyerMSP, buyerID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if buyerMSP == listing.SellerMSP && buyerID == listing.SellerID {
+		return "", fmt.Errorf("Seller cannot make an offer for %s", carNumber)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	offer := SaleOffer{
+		OfferID:   ctx.GetStub().GetTxID(),
+		CarNumber: carNumber,
+		Buyer:     buyer,
+		BuyerMSP:  buyerMSP,
+		BuyerID:   buyerID,
+		Amount:    offerAmount,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(time.Duration(validitySeconds) * time.Second).Format(time.RFC3339),
+	}
+
+	if err := putCarObject(ctx, listing.SellerMSP, saleOfferObjectType, []string{carNumber, offer.OfferID}, offer); err != nil {
+		return "", err
+	}
+
+	return offer.OfferID, nil
+}
+
+// QueryOffer returns the offer with given id made for the car with given id
+func (s *SmartContract) QueryOffer(ctx contractapi.TransactionContextInterface, carNumber string, offerID string) (*SaleOffer, error) {
+	offer := new(SaleOffer)
+
+	found, err := getCompositeObject(ctx, saleOfferObjectType, []string{carNumber, offerID}, offer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Offer %s for %s does not exist", offerID, carNumber)
+	}
+
+	return offer, nil
+}
+
+// QueryOffers returns all open offers, including expired ones, made for the car with given id
+func (s *SmartContract) QueryOffers(ctx contractapi.TransactionContextInterface, carNumber string) ([]SaleOffer, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(saleOfferObjectType, []string{carNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	offers := []SaleOffer{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		offer := SaleOffer{}
+
+		if err := json.Unmarshal(queryResponse.Value, &offer); err != nil {
+			return nil, fmt.Errorf("Failed to decode offer. %s", err.Error())
+		}
+
+		offers = append(offers, offer)
+	}
+
+	return offers, nil
+}
+
+// AcceptOffer sells the car with given id to the buyer of an unexpired offer.
+// Ownership moves to the buyer and the car price is set to the offered amount
+// in the same transaction, after which the listing and all offers are removed
+// and the car is marked Sold
+func (s *SmartContract) AcceptOffer(ctx contractapi.TransactionContextInterface, carNumber string, offerID string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if _, err := s.QuerySaleListing(ctx, carNumber); err != nil {
+		return err
+	}
+
+	offer, err := s.QueryOffer(ctx, carNumber, offerID)
+
+	if err != nil {
+		return err
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, offer.ExpiresAt)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read offer expiry. %s", err.Error())
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("Offer %s for %s expired at %s", offerID, carNumber, offer.ExpiresAt)
+	}
+
+	before := *car
+
+	if err := transitionCarStatus(carNumber, car, StatusSold); err != nil {
+		return err
+	}
+
+	car.Price = offer.Amount
+
+	if err := transferCar(ctx, carNumber, car, offer.Buyer, offer.BuyerMSP, offer.BuyerID); err != nil {
+		return err
+	}
+
+	if err := recordPriceChange(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, carSoldEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// CancelOffer withdraws an offer before it is accepted. Either the buyer who
+// made the offer or the seller of the car may cancel it
+func (s *SmartContract) CancelOffer(ctx contractapi.TransactionContextInterface, carNumber string, offerID string) error {
+	offer, err := s.QueryOffer(ctx, carNumber, offerID)
+
+	if err != nil {
+		return err
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if mspID != offer.BuyerMSP || clientID != offer.BuyerID {
+		car, err := s.QueryCar(ctx, carNumber)
+
+		if err != nil {
+			return err
+		}
+
+		if err := assertCarOwner(ctx, carNumber, car); err != nil {
+			return fmt.Errorf("Only the buyer or the seller may cancel offer %s", offerID)
+		}
+	}
+
+	return deleteCompositeObject(ctx, saleOfferObjectType, []string{carNumber, offerID})
+}
+
+// clearSale removes the sale listing of a car and every offer made for it
+func clearSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(saleOfferObjectType, []string{carNumber})
+
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return fmt.Errorf("Failed to delete offer from world state. %s", err.Error())
+		}
+	}
+
+	return deleteCompositeObject(ctx, saleListingObjectType, []string{carNumber})
+}
@@ -0,0 +1,234 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// listCar lists the car of the client for sale at askingPrice
+// in USD
+func (f *fabcarTest) listCar(owner *testClient, carNumber string, askingPrice int64) {
+	f.t.Helper()
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, carNumber, askingPrice, "USD")
+	}))
+}
+
+// makeOffer makes an offer of the buyer in USD valid for an hour and returns its id
+func (f *fabcarTest) makeOffer(buyer *testClient, carNumber string, amount int64) string {
+	f.t.Helper()
+
+	var offerID string
+
+	assertNoError(f.t, f.submit(buyer, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offerID, err = f.contract.MakeOffer(ctx, carNumber, "Bob", amount, "USD", 3600)
+		return err
+	}))
+
+	return offerID
+}
+
+// queryOffers returns the offers made for the car
+func (f *fabcarTest) queryOffers(carNumber string) []SaleOffer {
+	f.t.Helper()
+
+	var offers []SaleOffer
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offers, err = f.contract.QueryOffers(ctx, carNumber)
+		return err
+	}))
+
+	return offers
+}
+
+func TestListCarForSale(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", 90000, "USD")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", -1, "USD")
+	})
+	assertErrorContains(t, err, "asking price must not be negative")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ListCarForSale(ctx, "CAR10", 90000, "XXX")
+	})
+	assertContractError(t, err, CodeInvalidArgument)
+
+	f.listCar(f.alice, "CAR10", 90000)
+	assertEqual(t, f.queryCar("CAR10").Status, StatusForSale)
+	assertEqual(t, f.lastCarEvent().Type, statusChangedEvent)
+
+	f.listCar(f.alice, "CAR10", 85000)
+
+	var listing *SaleListing
+
+	assertNoError(t, f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		listing, err = f.contract.QuerySaleListing(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, *listing, SaleListing{
+		CarNumber:   "CAR10",
+		SellerMSP:   f.alice.MSPID,
+		SellerID:    f.alice.ID,
+		AskingPrice: Money{Amount: 85000, Currency: "USD"},
+		ListedAt:    "2021-01-01T00:00:07Z",
+	})
+}
+
+func TestDelistCar(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.DelistCar(ctx, "CAR10")
+	})
+	assertErrorContains(t, err, "CAR10 is not listed for sale")
+
+	f.listCar(f.alice, "CAR10", 90000)
+	f.makeOffer(f.bob, "CAR10", 80000)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.DelistCar(ctx, "CAR10")
+	}))
+	assertEqual(t, f.queryCar("CAR10").Status, StatusRegistered)
+	assertEqual(t, f.queryOffers("CAR10"), []SaleOffer{})
+
+	err = f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QuerySaleListing(ctx, "CAR10")
+		return err
+	})
+	assertErrorContains(t, err, "CAR10 is not listed for sale")
+}
+
+func TestMakeOffer(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeOffer(ctx, "CAR10", "Bob", 80000, "USD", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "CAR10 is not listed for sale")
+
+	f.listCar(f.alice, "CAR10", 90000)
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeOffer(ctx, "CAR10", "Alice", 80000, "USD", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "Seller cannot make an offer for CAR10")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeOffer(ctx, "CAR10", "Bob", 80000, "USD", 0)
+		return err
+	})
+	assertErrorContains(t, err, "Offer validity must be greater than zero")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeOffer(ctx, "CAR10", "Bob", 80000, "EUR", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "Offers for CAR10 must be made in USD")
+
+	offerID := f.makeOffer(f.bob, "CAR10", 80000)
+
+	var offer *SaleOffer
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offer, err = f.contract.QueryOffer(ctx, "CAR10", offerID)
+		return err
+	}))
+	assertEqual(t, *offer, SaleOffer{
+		OfferID:   offerID,
+		CarNumber: "CAR10",
+		Buyer:     "Bob",
+		BuyerMSP:  f.bob.MSPID,
+		BuyerID:   f.bob.ID,
+		Amount:    Money{Amount: 80000, Currency: "USD"},
+		CreatedAt: "2021-01-01T00:00:07Z",
+		ExpiresAt: "2021-01-01T01:00:07Z",
+	})
+	assertEqual(t, f.queryOffers("CAR10"), []SaleOffer{*offer})
+}
+
+func TestAcceptOffer(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+	offerID := f.makeOffer(f.bob, "CAR10", 80000)
+	f.makeOffer(f.bank, "CAR10", 70000)
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	}))
+
+	car := f.queryCar("CAR10")
+	assertEqual(t, car.Status, StatusSold)
+	assertEqual(t, car.OwnerID, f.bob.ID)
+	assertEqual(t, car.Price, Money{Amount: 80000, Currency: "USD"})
+	assertEqual(t, f.queryOffers("CAR10"), []SaleOffer{})
+	assertEqual(t, f.queryCarsByOwner("Bob"), []string{"CAR10"})
+
+	event := f.lastCarEvent()
+	assertEqual(t, event.Type, carSoldEvent)
+	assertEqual(t, event.Changes[0].Before.OwnerID, f.alice.ID)
+}
+
+func TestAcceptOfferExpired(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+	offerID := f.makeOffer(f.bob, "CAR10", 80000)
+	f.advance(time.Hour)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", offerID)
+	})
+	assertErrorContains(t, err, "expired at 2021-01-01T01:00:03Z")
+	assertEqual(t, f.queryCar("CAR10").OwnerID, f.alice.ID)
+}
+
+func TestCancelOffer(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.listCar(f.alice, "CAR10", 90000)
+	bobOffer := f.makeOffer(f.bob, "CAR10", 80000)
+	bankOffer := f.makeOffer(f.bank, "CAR10", 70000)
+
+	err := f.submit(f.bank, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelOffer(ctx, "CAR10", bobOffer)
+	})
+	assertErrorContains(t, err, "Only the buyer or the seller may cancel offer "+bobOffer)
+
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelOffer(ctx, "CAR10", bobOffer)
+	}))
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CancelOffer(ctx, "CAR10", bankOffer)
+	}))
+	assertEqual(t, f.queryOffers("CAR10"), []SaleOffer{})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptOffer(ctx, "CAR10", bobOffer)
+	})
+	assertErrorContains(t, err, "Offer "+bobOffer+" for CAR10 does not exist")
+}
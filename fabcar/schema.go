@@ -0,0 +1,203 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// currentCarSchemaVersion is the schema version putCar writes. Cars written
+// before the schema was versioned have no schemaVersion and are version 0.
+// Bump it together with an entry in carUpgrades whenever the stored layout of
+// Car changes
+const currentCarSchemaVersion = 2
+
+// carUpgrade rewrites the stored JSON fields of a car from one schema version
+// to the next
+type carUpgrade func(fields map[string]interface{}) error
+
+// carUpgrades holds the upgrade of every schema version older than the current
+// one, keyed by the version it upgrades from
+var carUpgrades = map[int]carUpgrade{
+	0: upgradeCarFromV0,
+	1: upgradeCarFromV1,
+}
+
+// MigrationResult structure used for handling a page of migrated cars
+type MigrationResult struct {
+	Migrated            int32  `json:"migrated"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	Bookmark            string `json:"bookmark"`
+}
+
+// MigrateCars rewrites the cars on a page of at most pageSize records starting
+// at bookmark in the current schema version, together with the bookmark of the
+// next page. Only admins of the registry organisation may migrate cars. Cars
+// with a key-level endorsement policy still need the endorsement of their owner
+// organisation, so the transaction should be sent to peers of every organisation
+func (s *SmartContract) MigrateCars(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	if err := assertRegistryAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := carSchemaVersion(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if version == currentCarSchemaVersion {
+			continue
+		}
+
+		car, err := decodeCar(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := putCar(ctx, queryResponse.Key, car); err != nil {
+			return nil, err
+		}
+
+		result.Migrated++
+	}
+
+	result.FetchedRecordsCount = responseMetadata.FetchedRecordsCount
+	result.Bookmark = responseMetadata.Bookmark
+
+	return result, nil
+}
+
+// decodeCar decodes a car stored under carNumber in any known schema version,
+// applying the upgrades up to the current version
+func decodeCar(carNumber string, carAsBytes []byte) (*Car, error) {
+	version, err := carSchemaVersion(carNumber, carAsBytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	car := new(Car)
+
+	if version == currentCarSchemaVersion {
+		if err := json.Unmarshal(carAsBytes, car); err != nil {
+			return nil, fmt.Errorf("Failed to decode %s. %s", carNumber, err.Error())
+		}
+
+		return car, nil
+	}
+
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(carAsBytes))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("Failed to decode %s. %s", carNumber, err.Error())
+	}
+
+	for ; version < currentCarSchemaVersion; version++ {
+		upgrade, ok := carUpgrades[version]
+
+		if !ok {
+			return nil, fmt.Errorf("No upgrade of %s from schema version %d", carNumber, version)
+		}
+
+		if err := upgrade(fields); err != nil {
+			return nil, fmt.Errorf("Failed to upgrade %s from schema version %d. %s", carNumber, version, err.Error())
+		}
+	}
+
+	fields["schemaVersion"] = currentCarSchemaVersion
+	upgradedAsBytes, err := json.Marshal(fields)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode %s. %s", carNumber, err.Error())
+	}
+
+	if err := json.Unmarshal(upgradedAsBytes, car); err != nil {
+		return nil, fmt.Errorf("Failed to decode %s. %s", carNumber, err.Error())
+	}
+
+	return car, nil
+}
+
+// carSchemaVersion returns the schema version of a stored car, rejecting
+// versions written by a newer chaincode
+func carSchemaVersion(carNumber string, carAsBytes []byte) (int, error) {
+	header := struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}{}
+
+	if err := json.Unmarshal(carAsBytes, &header); err != nil {
+		return 0, fmt.Errorf("Failed to decode %s. %s", carNumber, err.Error())
+	}
+
+	if header.SchemaVersion < 0 || header.SchemaVersion > currentCarSchemaVersion {
+		return 0, fmt.Errorf("%s has unsupported schema version %d, the chaincode supports up to %d", carNumber, header.SchemaVersion, currentCarSchemaVersion)
+	}
+
+	return header.SchemaVersion, nil
+}
+
+// upgradeCarFromV0 sets the status of cars written before the lifecycle was
+// tracked to Registered
+func upgradeCarFromV0(fields map[string]interface{}) error {
+	if status, ok := fields["status"]; !ok || status == "" {
+		fields["status"] = string(StatusRegistered)
+	}
+
+	return nil
+}
+
+// upgradeCarFromV1 turns the plain integer price into Money in whole units of
+// the default currency
+func upgradeCarFromV1(fields map[string]interface{}) error {
+	units := int64(0)
+
+	if price, ok := fields["price"]; ok && price != nil {
+		number, ok := price.(json.Number)
+
+		if !ok {
+			return fmt.Errorf("price %v is not a number", price)
+		}
+
+		value, err := number.Int64()
+
+		if err != nil {
+			return fmt.Errorf("price %s is not an integer", number)
+		}
+
+		units = value
+	}
+
+	fields["price"] = moneyFromWholeUnits(units, defaultCurrency)
+
+	return nil
+}
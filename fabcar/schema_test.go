@@ -0,0 +1,103 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// putLegacyCar writes a car as stored by an older chaincode, bypassing the contract
+func (f *fabcarTest) putLegacyCar(carNumber string, carJSON string) {
+	f.t.Helper()
+
+	f.stub.MockTransactionStart("legacy")
+	defer f.stub.MockTransactionEnd("legacy")
+
+	assertNoError(f.t, f.stub.MockStub.PutState(carNumber, []byte(carJSON)))
+}
+
+func TestDecodeCarUpgradesOldVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		carJSON string
+		want    Car
+	}{
+		{
+			"version 0",
+			`{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","price":10000}`,
+			Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Price: Money{Amount: 1000000, Currency: "USD"}, Status: StatusRegistered, SchemaVersion: currentCarSchemaVersion},
+		},
+		{
+			"version 1",
+			`{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","price":250,"status":"Stolen","schemaVersion":1}`,
+			Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Price: Money{Amount: 25000, Currency: "USD"}, Status: StatusStolen, SchemaVersion: currentCarSchemaVersion},
+		},
+		{
+			"version 1 without price",
+			`{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","status":"Sold","schemaVersion":1}`,
+			Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Price: Money{Amount: 0, Currency: "USD"}, Status: StatusSold, SchemaVersion: currentCarSchemaVersion},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			car, err := decodeCar("CAR0", []byte(tt.carJSON))
+
+			assertNoError(t, err)
+			assertEqual(t, *car, tt.want)
+		})
+	}
+}
+
+func TestDecodeCarRejectsUnsupportedVersions(t *testing.T) {
+	_, err := decodeCar("CAR0", []byte(`{"make":"Toyota","schemaVersion":3}`))
+	assertErrorContains(t, err, "CAR0 has unsupported schema version 3, the chaincode supports up to 2")
+
+	_, err = decodeCar("CAR0", []byte(`{"make":"Toyota","price":12.5,"schemaVersion":1}`))
+	assertErrorContains(t, err, "Failed to upgrade CAR0 from schema version 1. price 12.5 is not an integer")
+}
+
+func TestMigrateCars(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+	f.putLegacyCar("CAR0", `{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","price":10000}`)
+	f.putLegacyCar("CAR1", `{"make":"Ford","model":"Mustang","colour":"red","owner":"Brad","price":20000,"status":"ForSale","schemaVersion":1}`)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MigrateCars(ctx, 2, "")
+		return err
+	})
+	assertErrorContains(t, err, "Submitting client is not a Org1MSP admin")
+
+	results := []MigrationResult{}
+	bookmark := ""
+
+	for {
+		var result *MigrationResult
+
+		assertNoError(t, f.submit(f.admin, func(ctx contractapi.TransactionContextInterface) (err error) {
+			result, err = f.contract.MigrateCars(ctx, 2, bookmark)
+			return err
+		}))
+
+		results = append(results, *result)
+
+		if result.Bookmark == "" {
+			break
+		}
+
+		bookmark = result.Bookmark
+	}
+
+	assertEqual(t, results, []MigrationResult{
+		{Migrated: 2, FetchedRecordsCount: 2, Bookmark: "CAR10"},
+		{Migrated: 0, FetchedRecordsCount: 1, Bookmark: ""},
+	})
+	assertEqual(t, string(f.stub.State["CAR1"]), `{"make":"Ford","model":"Mustang","colour":"red","owner":"Brad","price":{"amount":2000000,"currency":"USD"},"status":"ForSale","schemaVersion":2}`)
+	assertEqual(t, f.queryCar("CAR0").Status, StatusRegistered)
+	assertEqual(t, len(f.stub.history["CAR10"]), 1)
+}
@@ -0,0 +1,157 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Service records are stored per car under composite keys whose sequence is
+// zero padded, so that the records of a car are iterated in the order written
+const (
+	serviceRecordObjectType = "service~carNumber~sequence"
+	serviceSequenceFormat   = "%010d"
+	serviceDateLayout       = "2006-01-02"
+)
+
+// ServiceRecord describes a service of a car at a workshop. The workshop
+// identity is the client that recorded the service
+type ServiceRecord struct {
+	CarNumber   string `json:"carNumber"`
+	Sequence    int    `json:"sequence"`
+	Odometer    int    `json:"odometer"`
+	Workshop    string `json:"workshop"`
+	WorkshopMSP string `json:"workshopMSP"`
+	WorkshopID  string `json:"workshopID"`
+	ServiceDate string `json:"serviceDate"`
+	Description string `json:"description,omitempty"`
+	RecordedAt  string `json:"recordedAt"`
+}
+
+// AddServiceRecord records a service of the car with given id on serviceDate,
+// given as YYYY-MM-DD, at the odometer reading in kilometres. The reading must
+// not be lower than the last one recorded for the car, which would point to an
+// odometer rollback. The sequence number of the record is returned
+func (s *SmartContract) AddServiceRecord(ctx contractapi.TransactionContextInterface, carNumber string, workshop string, serviceDate string, odometer int, description string) (int, error) {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := assertCarActive(carNumber, car); err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(workshop) == "" {
+		return 0, newContractError(CodeInvalidArgument, "workshop must not be empty")
+	}
+
+	if odometer < 0 {
+		return 0, newContractError(CodeInvalidArgument, "odometer must not be negative, got %d", odometer)
+	}
+
+	date, err := time.Parse(serviceDateLayout, serviceDate)
+
+	if err != nil {
+		return 0, newContractError(CodeInvalidArgument, "serviceDate must be in YYYY-MM-DD format, got %q", serviceDate)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if date.After(now) {
+		return 0, newContractError(CodeInvalidArgument, "serviceDate %s is in the future", serviceDate)
+	}
+
+	records, err := getServiceLog(ctx, carNumber)
+
+	if err != nil {
+		return 0, err
+	}
+
+	sequence := 1
+
+	if len(records) > 0 {
+		last := records[len(records)-1]
+
+		if odometer < last.Odometer {
+			return 0, fmt.Errorf("Odometer reading %d of %s is lower than %d recorded in service %d", odometer, carNumber, last.Odometer, last.Sequence)
+		}
+
+		sequence = last.Sequence + 1
+	}
+
+	workshopMSP, workshopID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	record := ServiceRecord{
+		CarNumber:   carNumber,
+		Sequence:    sequence,
+		Odometer:    odometer,
+		Workshop:    workshop,
+		WorkshopMSP: workshopMSP,
+		WorkshopID:  workshopID,
+		ServiceDate: date.Format(serviceDateLayout),
+		Description: description,
+		RecordedAt:  now.Format(time.RFC3339),
+	}
+
+	if err := putCarObject(ctx, car.OwnerMSP, serviceRecordObjectType, []string{carNumber, fmt.Sprintf(serviceSequenceFormat, sequence)}, record); err != nil {
+		return 0, err
+	}
+
+	return sequence, nil
+}
+
+// QueryServiceLog returns every service record of the car with given id, oldest first
+func (s *SmartContract) QueryServiceLog(ctx contractapi.TransactionContextInterface, carNumber string) ([]ServiceRecord, error) {
+	if _, err := s.QueryCar(ctx, carNumber); err != nil {
+		return nil, err
+	}
+
+	return getServiceLog(ctx, carNumber)
+}
+
+// getServiceLog returns the service records of the car in sequence order
+func getServiceLog(ctx contractapi.TransactionContextInterface, carNumber string) ([]ServiceRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(serviceRecordObjectType, []string{carNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []ServiceRecord{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		record := ServiceRecord{}
+
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return nil, fmt.Errorf("Failed to decode service record. %s", err.Error())
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
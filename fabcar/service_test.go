@@ -0,0 +1,109 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// addServiceRecord records a service of the car by the workshop client and returns its sequence number
+func (f *fabcarTest) addServiceRecord(workshop *testClient, carNumber string, serviceDate string, odometer int) (int, error) {
+	f.t.Helper()
+
+	var sequence int
+
+	err := f.submit(workshop, func(ctx contractapi.TransactionContextInterface) (err error) {
+		sequence, err = f.contract.AddServiceRecord(ctx, carNumber, "Garage", serviceDate, odometer, "Oil change")
+		return err
+	})
+
+	return sequence, err
+}
+
+func TestAddServiceRecord(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	sequence, err := f.addServiceRecord(f.bob, "CAR10", "2020-06-01", 15000)
+	assertNoError(t, err)
+	assertEqual(t, sequence, 1)
+
+	sequence, err = f.addServiceRecord(f.bob, "CAR10", "2020-12-01", 15000)
+	assertNoError(t, err)
+	assertEqual(t, sequence, 2)
+
+	var records []ServiceRecord
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		records, err = f.contract.QueryServiceLog(ctx, "CAR10")
+		return err
+	}))
+	assertEqual(t, len(records), 2)
+	assertEqual(t, records[0], ServiceRecord{
+		CarNumber:   "CAR10",
+		Sequence:    1,
+		Odometer:    15000,
+		Workshop:    "Garage",
+		WorkshopMSP: f.bob.MSPID,
+		WorkshopID:  f.bob.ID,
+		ServiceDate: "2020-06-01",
+		Description: "Oil change",
+		RecordedAt:  "2021-01-01T00:00:02Z",
+	})
+	assertEqual(t, records[1].ServiceDate, "2020-12-01")
+}
+
+func TestAddServiceRecordDetectsOdometerRollback(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	_, err := f.addServiceRecord(f.bob, "CAR10", "2020-06-01", 15000)
+	assertNoError(t, err)
+
+	_, err = f.addServiceRecord(f.bob, "CAR10", "2020-12-01", 14999)
+	assertErrorContains(t, err, "Odometer reading 14999 of CAR10 is lower than 15000 recorded in service 1")
+}
+
+func TestAddServiceRecordRejectsInvalidDetails(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceDate string
+		odometer    int
+	}{
+		{"negative odometer", "2020-06-01", -1},
+		{"malformed date", "01/06/2020", 1},
+		{"future date", "2021-01-02", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFabcarTest(t)
+			f.createCar(f.alice, "CAR10")
+
+			_, err := f.addServiceRecord(f.bob, "CAR10", tt.serviceDate, tt.odometer)
+			assertContractError(t, err, CodeInvalidArgument)
+		})
+	}
+}
+
+func TestAddServiceRecordToScrappedCar(t *testing.T) {
+	f := newFabcarTest(t)
+	f.createCar(f.alice, "CAR10")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ScrapCar(ctx, "CAR10")
+	}))
+
+	_, err := f.addServiceRecord(f.bob, "CAR10", "2020-06-01", 15000)
+	assertErrorContains(t, err, "CAR10 is Scrapped")
+
+	err = f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryServiceLog(ctx, "CAR404")
+		return err
+	})
+	assertErrorContains(t, err, "CAR404 does not exist")
+}
@@ -0,0 +1,205 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// vinIndexName is the object type of the composite keys mapping a VIN to the
+// key its car is stored under, either the VIN itself or a car number alias
+const vinIndexName = "vin~carNumber"
+
+// vinLength is the length of a vehicle identification number
+const vinLength = 17
+
+// vinCheckDigitPosition is the index of the check digit within a VIN
+const vinCheckDigitPosition = 8
+
+// vinWeights are the weights of the VIN positions in the check digit sum
+var vinWeights = [vinLength]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinLetterValues are the values letters are transliterated to for the check
+// digit. I, O and Q are not allowed in a VIN
+var vinLetterValues = map[rune]int{
+	'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+	'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+	'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+}
+
+// QueryCarByVIN returns the car with given VIN together with the key it is
+// stored under, whether it was created under the VIN or a car number
+func (s *SmartContract) QueryCarByVIN(ctx contractapi.TransactionContextInterface, vin string) (*QueryResult, error) {
+	vin = normalizeVIN(vin)
+	carNumber, found, err := resolveVIN(ctx, vin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("No car with VIN %s exists", vin)
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryResult{Key: carNumber, Record: car}, nil
+}
+
+// AssignCarVIN records the VIN of a car created before VINs were tracked, so
+// that it can be looked up by VIN too. Only the owner may assign the VIN and
+// it cannot be changed afterwards
+func (s *SmartContract) AssignCarVIN(ctx contractapi.TransactionContextInterface, carNumber string, vin string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertCarOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if car.VIN != "" {
+		return fmt.Errorf("%s already has VIN %s", carNumber, car.VIN)
+	}
+
+	vin = normalizeVIN(vin)
+
+	if err := validateVIN(vin); err != nil {
+		return err
+	}
+
+	if err := assertVINNotRegistered(ctx, vin, carNumber); err != nil {
+		return err
+	}
+
+	before := *car
+	car.VIN = vin
+
+	if err := putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := putVINIndex(ctx, vin, carNumber, car.OwnerMSP); err != nil {
+		return err
+	}
+
+	return emitCarEvent(ctx, vinAssignedEvent, CarChange{CarNumber: carNumber, Before: &before, After: car})
+}
+
+// normalizeVIN trims the VIN and converts it to upper case
+func normalizeVIN(vin string) string {
+	return strings.ToUpper(strings.TrimSpace(vin))
+}
+
+// validateVIN checks the length, characters and check digit of a normalized
+// VIN following ISO 3779 with the North American check digit
+func validateVIN(vin string) error {
+	if len(vin) != vinLength {
+		return newContractError(CodeInvalidArgument, "VIN %q must be %d characters long", vin, vinLength)
+	}
+
+	sum := 0
+
+	for i, c := range vin {
+		value, ok := vinLetterValues[c]
+
+		if c >= '0' && c <= '9' {
+			value, ok = int(c-'0'), true
+		}
+
+		if !ok {
+			return newContractError(CodeInvalidArgument, "VIN %q contains invalid character %q", vin, c)
+		}
+
+		sum += value * vinWeights[i]
+	}
+
+	checkDigit := byte('0' + sum%11)
+
+	if sum%11 == 10 {
+		checkDigit = 'X'
+	}
+
+	if vin[vinCheckDigitPosition] != checkDigit {
+		return newContractError(CodeInvalidArgument, "VIN %q has check digit %c, expected %c", vin, vin[vinCheckDigitPosition], checkDigit)
+	}
+
+	return nil
+}
+
+// assertVINNotRegistered returns an AlreadyExists error if a car other than
+// carNumber is indexed under the VIN or stored under it as its key
+func assertVINNotRegistered(ctx contractapi.TransactionContextInterface, vin string, carNumber string) error {
+	registered, found, err := resolveVIN(ctx, vin)
+
+	if err != nil {
+		return err
+	}
+
+	if found && registered != carNumber {
+		return newContractError(CodeAlreadyExists, "VIN %s is already registered to %s", vin, registered)
+	}
+
+	return nil
+}
+
+// resolveVIN returns the key of the car with given VIN. Cars stored under the
+// VIN as key without an index entry are found as well
+func resolveVIN(ctx contractapi.TransactionContextInterface, vin string) (string, bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(vinIndexName, []string{vin})
+
+	if err != nil {
+		return "", false, err
+	}
+	defer resultsIterator.Close()
+
+	if resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return "", false, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+
+		if err != nil {
+			return "", false, fmt.Errorf("Failed to split index key. %s", err.Error())
+		}
+
+		return keyParts[len(keyParts)-1], true, nil
+	}
+
+	carAsBytes, err := ctx.GetStub().GetState(vin)
+
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	return vin, carAsBytes != nil, nil
+}
+
+// putVINIndex adds the VIN index entry of the car owned by ownerMSP
+func putVINIndex(ctx contractapi.TransactionContextInterface, vin string, carNumber string, ownerMSP string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(vinIndexName, []string{vin, carNumber})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create index key. %s", err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("Failed to put index to world state. %s", err.Error())
+	}
+
+	return setCarObjectEndorsementPolicy(ctx, carNumber, indexKey, ownerMSP)
+}
@@ -0,0 +1,86 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// queryCarByVIN returns the key and car found under the VIN
+func (f *fabcarTest) queryCarByVIN(vin string) (*QueryResult, error) {
+	f.t.Helper()
+
+	var result *QueryResult
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		result, err = f.contract.QueryCarByVIN(ctx, vin)
+		return err
+	})
+
+	return result, err
+}
+
+func TestValidateVIN(t *testing.T) {
+	assertNoError(t, validateVIN("1M8GDM9AXKP042788"))
+	assertNoError(t, validateVIN("11111111111111111"))
+	assertContractError(t, validateVIN("1M8GDM9AXKP04278O"), CodeInvalidArgument)
+	assertContractError(t, validateVIN("1M8GDM9A1KP042788"), CodeInvalidArgument)
+	assertContractError(t, validateVIN("1M8GDM9AXKP0427888"), CodeInvalidArgument)
+}
+
+func TestQueryCarByVIN(t *testing.T) {
+	f := newFabcarTest(t)
+	aliasVIN := f.createCar(f.alice, "CAR10")
+	keyVIN := f.createCar(f.alice, "")
+
+	result, err := f.queryCarByVIN(" " + strings.ToLower(aliasVIN) + " ")
+	assertNoError(t, err)
+	assertEqual(t, result.Key, "CAR10")
+	assertEqual(t, result.Record.VIN, aliasVIN)
+
+	result, err = f.queryCarByVIN(keyVIN)
+	assertNoError(t, err)
+	assertEqual(t, result.Key, keyVIN)
+
+	_, err = f.queryCarByVIN(testVIN(99))
+	assertErrorContains(t, err, "No car with VIN "+testVIN(99)+" exists")
+}
+
+func TestAssignCarVIN(t *testing.T) {
+	f := newFabcarTest(t)
+	f.initLedger()
+	f.createCar(f.alice, "CAR10")
+
+	assertNoError(t, f.submit(f.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.BindCarOwner(ctx, "CAR0", f.alice.MSPID, f.alice.ID)
+	}))
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignCarVIN(ctx, "CAR0", testVIN(50))
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of CAR0")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignCarVIN(ctx, "CAR0", f.queryCar("CAR10").VIN)
+	})
+	assertContractError(t, err, CodeAlreadyExists)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignCarVIN(ctx, "CAR0", testVIN(50))
+	}))
+	assertEqual(t, f.lastCarEvent().Type, vinAssignedEvent)
+
+	result, err := f.queryCarByVIN(testVIN(50))
+	assertNoError(t, err)
+	assertEqual(t, result.Key, "CAR0")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignCarVIN(ctx, "CAR0", testVIN(51))
+	})
+	assertErrorContains(t, err, "CAR0 already has VIN "+testVIN(50))
+}
@@ -8,71 +8,122 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+const (
+	// landRegistryMSPID is the organisation of the land registry
+	landRegistryMSPID = "Org3MSP"
+	// landRegistryAttribute is the certificate attribute identifying clients of
+	// the land registry, who may transfer any Real Estate. Set it with value
+	// true when registering those clients with the Fabric CA of landRegistryMSPID
+	landRegistryAttribute = "landRegistry"
+)
+
 // SmartContract provides functions for managing a real estate
 type SmartContract struct {
 	contractapi.Contract
 }
 
-// RealEstate describes basic details of what makes up a real estate
+// RealEstate describes basic details of what makes up a real estate. The
+// living space is in square metres. Owner is the name of the owner, OwnerMSP
+// and OwnerID identify the client that owns it. Real Estates written before
+// owners were identified have no owner identity
 type RealEstate struct {
-	Location    string `json:"location"`
-	Rooms       string `json:"rooms"`
-	Baths       string `json:"baths"`
-	Price       string `json:"price"`
-	LivingSpace string `json:"livingSpace"`
-	Owner       string `json:"owner"`
+	Location    string  `json:"location"`
+	Rooms       int     `json:"rooms"`
+	Baths       int     `json:"baths"`
+	Price       Money   `json:"price"`
+	LivingSpace float64 `json:"livingSpace"`
+	Owner       string  `json:"owner"`
+	OwnerMSP    string  `json:"ownerMSP,omitempty"`
+	OwnerID     string  `json:"ownerID,omitempty"`
 }
 
-// QueryResult structure used for handling result of query
+// QueryResult structure used for handling result of query. Records that
+// cannot be read have no Record and the reason in Error instead
 type QueryResult struct {
-	Key    string `json:"Key"`
-	Record *RealEstate
+	Key    string      `json:"Key"`
+	Record *RealEstate `json:"Record,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// PaginatedQueryResult structure used for handling a page of query results
+type PaginatedQueryResult struct {
+	Records             []QueryResult `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
 }
 
 // InitLedger adds a base set of Real Estates to the ledger
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	realEstates := []RealEstate{
-		RealEstate{Location: "Istanbul", Rooms: "5", Baths: "2", Price: "$140,000", LivingSpace: "120m2", Owner: "Agency"},
-		RealEstate{Location: "Izmir", Rooms: "3", Baths: "1", Price: "$75,000", LivingSpace: "90m2", Owner: "Agency"},
-		RealEstate{Location: "Ankara", Rooms: "4", Baths: "2", Price: "$135,000", LivingSpace: "140m2", Owner: "Agency"},
-		RealEstate{Location: "Istanbul", Rooms: "1", Baths: "1", Price: "$300,000", LivingSpace: "40m2", Owner: "Agency"},
-		RealEstate{Location: "Bursa", Rooms: "5", Baths: "2", Price: "$100,000", LivingSpace: "200m2", Owner: "Agency"},
-		RealEstate{Location: "Istanbul", Rooms: "2", Baths: "1", Price: "$55,000", LivingSpace: "80m2", Owner: "Agency"},
-		RealEstate{Location: "Ankara", Rooms: "3", Baths: "1", Price: "$90,000", LivingSpace: "120m2", Owner: "Agency"},
-		RealEstate{Location: "Istanbul", Rooms: "7", Baths: "3", Price: "$1,135,500", LivingSpace: "370m2", Owner: "Agency"},
-		RealEstate{Location: "Izmir", Rooms: "2", Baths: "1", Price: "$55,000", LivingSpace: "80m2", Owner: "Agency"},
+		RealEstate{Location: "Istanbul", Rooms: 5, Baths: 2, Price: moneyFromWholeUnits(140000, "USD"), LivingSpace: 120, Owner: "Agency"},
+		RealEstate{Location: "Izmir", Rooms: 3, Baths: 1, Price: moneyFromWholeUnits(75000, "USD"), LivingSpace: 90, Owner: "Agency"},
+		RealEstate{Location: "Ankara", Rooms: 4, Baths: 2, Price: moneyFromWholeUnits(135000, "USD"), LivingSpace: 140, Owner: "Agency"},
+		RealEstate{Location: "Istanbul", Rooms: 1, Baths: 1, Price: moneyFromWholeUnits(300000, "USD"), LivingSpace: 40, Owner: "Agency"},
+		RealEstate{Location: "Bursa", Rooms: 5, Baths: 2, Price: moneyFromWholeUnits(100000, "USD"), LivingSpace: 200, Owner: "Agency"},
+		RealEstate{Location: "Istanbul", Rooms: 2, Baths: 1, Price: moneyFromWholeUnits(55000, "USD"), LivingSpace: 80, Owner: "Agency"},
+		RealEstate{Location: "Ankara", Rooms: 3, Baths: 1, Price: moneyFromWholeUnits(90000, "USD"), LivingSpace: 120, Owner: "Agency"},
+		RealEstate{Location: "Istanbul", Rooms: 7, Baths: 3, Price: moneyFromWholeUnits(1135500, "USD"), LivingSpace: 370, Owner: "Agency"},
+		RealEstate{Location: "Izmir", Rooms: 2, Baths: 1, Price: moneyFromWholeUnits(55000, "USD"), LivingSpace: 80, Owner: "Agency"},
 	}
 
 	for i, re := range realEstates {
-		reAsBytes, _ := json.Marshal(re)
-		err := ctx.GetStub().PutState("RE"+strconv.Itoa(i), reAsBytes)
-
-		if err != nil {
-			return fmt.Errorf("Failed to put to world state. %s", err.Error())
+		if err := putRe(ctx, "RE"+strconv.Itoa(i), &re); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// AddRe adds a new Real Estate to the world state with given details
-func (s *SmartContract) AddRe(ctx contractapi.TransactionContextInterface, reNumber string, location string, rooms string, baths string, price string, livingSpace string) error {
+// AddRe adds a new Real Estate to the world state with given details, owned
+// by the submitting client under the common name of its certificate. The
+// price is a decimal amount such as 140000.50 in the ISO 4217 currency and the
+// living space is in square metres. Existing Real Estate ids are rejected
+func (s *SmartContract) AddRe(ctx contractapi.TransactionContextInterface, reNumber string, location string, rooms int, baths int, price string, currency string, livingSpace float64) error {
+	amount, err := parseDecimalAmount(price, currency)
+
+	if err != nil {
+		return err
+	}
+
+	ownerMSP, ownerID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	owner, err := getSubmittingClientName(ctx)
+
+	if err != nil {
+		return err
+	}
+
 	re := RealEstate{
 		Location:    location,
 		Rooms:       rooms,
 		Baths:       baths,
-		Price:       price,
+		Price:       Money{Amount: amount, Currency: currency},
 		LivingSpace: livingSpace,
-		Owner:       "Agency",
+		Owner:       owner,
+		OwnerMSP:    ownerMSP,
+		OwnerID:     ownerID,
 	}
 
-	reAsBytes, _ := json.Marshal(re)
+	if err := validateRe(reNumber, &re); err != nil {
+		return err
+	}
+
+	if err := assertReDoesNotExist(ctx, reNumber); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(reNumber, reAsBytes)
+	return putRe(ctx, reNumber, &re)
 }
 
 // QueryRe returns the Real Estate stored in the world state with given id
@@ -87,13 +138,13 @@ func (s *SmartContract) QueryRe(ctx contractapi.TransactionContextInterface, reN
 		return nil, fmt.Errorf("%s does not exist", reNumber)
 	}
 
-	re := new(RealEstate)
-	_ = json.Unmarshal(reAsBytes, re)
+	re, _, err := decodeRe(reNumber, reAsBytes)
 
-	return re, nil
+	return re, err
 }
 
-// QueryAllRes returns all Real Estates found in world state
+// QueryAllRes returns all Real Estates found in world state. A record that
+// cannot be read is returned with the reason instead of failing the query
 func (s *SmartContract) QueryAllRes(ctx contractapi.TransactionContextInterface) ([]QueryResult, error) {
 	startKey := ""
 	endKey := ""
@@ -114,44 +165,297 @@ func (s *SmartContract) QueryAllRes(ctx contractapi.TransactionContextInterface)
 			return nil, err
 		}
 
-		re := new(RealEstate)
-		_ = json.Unmarshal(queryResponse.Value, re)
-
-		queryResult := QueryResult{Key: queryResponse.Key, Record: re}
+		queryResult, _ := newQueryResult(queryResponse.Key, queryResponse.Value)
 		results = append(results, queryResult)
 	}
 
 	return results, nil
 }
 
-// ChangeReOwner updates the owner field of Real Estate with given id in world state
-func (s *SmartContract) ChangeReOwner(ctx contractapi.TransactionContextInterface, reNumber string, newOwner string) error {
+// newQueryResult decodes a Real Estate read by a query into a QueryResult,
+// which holds the decoding error if it cannot be read, and reports whether it
+// was stored with string fields
+func newQueryResult(reNumber string, reAsBytes []byte) (QueryResult, bool) {
+	re, legacy, err := decodeRe(reNumber, reAsBytes)
+
+	if err != nil {
+		return QueryResult{Key: reNumber, Error: err.Error()}, false
+	}
+
+	return QueryResult{Key: reNumber, Record: re}, legacy
+}
+
+// ChangeReOwner transfers the Real Estate with given id to a new owner
+// identity. Only the current owner or a client of the land registry may
+// submit the transfer, which supersedes all open purchase offers. A Real
+// Estate under a lease in force only passes to the owner the lease is assigned
+// to and a tokenized one only through TransferShares
+func (s *SmartContract) ChangeReOwner(ctx contractapi.TransactionContextInterface, reNumber string, newOwner string, newOwnerMSP string, newOwnerID string) error {
 	re, err := s.QueryRe(ctx, reNumber)
 
 	if err != nil {
 		return err
 	}
 
+	if err := assertReOwnerOrLandRegistry(ctx, reNumber, re); err != nil {
+		return err
+	}
+
+	if err := assertNotTokenized(ctx, reNumber); err != nil {
+		return err
+	}
+
+	if newOwnerMSP == "" || newOwnerID == "" {
+		return fmt.Errorf("New owner MSP ID and client ID must be provided")
+	}
+
 	re.Owner = newOwner
+	re.OwnerMSP = newOwnerMSP
+	re.OwnerID = newOwnerID
 
-	reAsBytes, _ := json.Marshal(re)
+	if err := transferLeases(ctx, reNumber, newOwnerMSP, newOwnerID); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(reNumber, reAsBytes)
+	if err := supersedeOpenReOffers(ctx, reNumber, ""); err != nil {
+		return err
+	}
+
+	return putRe(ctx, reNumber, re)
 }
 
-// ChangeRePrice updates the price field of Real Estate with given id in world state
-func (s *SmartContract) ChangeRePrice(ctx contractapi.TransactionContextInterface, reNumber string, newPrice string) error {
+// ChangeRePrice updates the price field of Real Estate with given id in world
+// state to a decimal amount in the ISO 4217 currency. Only the owner may
+// change the price
+func (s *SmartContract) ChangeRePrice(ctx contractapi.TransactionContextInterface, reNumber string, newPrice string, currency string) error {
 	re, err := s.QueryRe(ctx, reNumber)
 
 	if err != nil {
 		return err
 	}
 
-	re.Price = newPrice
+	if err := assertReOwner(ctx, reNumber, re); err != nil {
+		return err
+	}
+
+	amount, err := parseDecimalAmount(newPrice, currency)
+
+	if err != nil {
+		return err
+	}
+
+	re.Price = Money{Amount: amount, Currency: currency}
+
+	return putRe(ctx, reNumber, re)
+}
+
+// validateRe checks the details of a Real Estate before it is stored
+func validateRe(reNumber string, re *RealEstate) error {
+	if strings.TrimSpace(reNumber) == "" {
+		return fmt.Errorf("Real Estate id must not be empty")
+	}
+
+	if strings.TrimSpace(re.Location) == "" {
+		return fmt.Errorf("Location of %s must not be empty", reNumber)
+	}
+
+	if re.Rooms <= 0 {
+		return fmt.Errorf("Rooms of %s must be greater than zero", reNumber)
+	}
+
+	if re.Baths < 0 {
+		return fmt.Errorf("Baths of %s must not be negative", reNumber)
+	}
+
+	if re.LivingSpace <= 0 {
+		return fmt.Errorf("Living space of %s must be greater than zero", reNumber)
+	}
+
+	return nil
+}
+
+// getSubmittingClientIdentity returns the MSP ID and client ID of the submitting client
+func getSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read client ID. %s", err.Error())
+	}
+
+	return mspID, clientID, nil
+}
+
+// getSubmittingClientName returns the common name of the certificate of the submitting client
+func getSubmittingClientName(ctx contractapi.TransactionContextInterface) (string, error) {
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read client certificate. %s", err.Error())
+	}
+
+	if cert == nil {
+		return "", fmt.Errorf("Submitting client has no X.509 certificate")
+	}
+
+	return cert.Subject.CommonName, nil
+}
+
+// assertReOwner returns an error unless the submitting client is the recorded owner of the Real Estate
+func assertReOwner(ctx contractapi.TransactionContextInterface, reNumber string, re *RealEstate) error {
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if re.OwnerMSP == "" || re.OwnerID == "" || mspID != re.OwnerMSP || clientID != re.OwnerID {
+		return fmt.Errorf("Submitting client is not the owner of %s", reNumber)
+	}
+
+	return nil
+}
+
+// assertReOwnerOrLandRegistry returns an error unless the submitting client is
+// the recorded owner of the Real Estate or a member of the land registry
+// organisation holding the land registry attribute. The attribute alone is not
+// enough, as the CA of any organisation can issue it. Real Estates without an
+// owner identity can only be transferred by the land registry
+func assertReOwnerOrLandRegistry(ctx contractapi.TransactionContextInterface, reNumber string, re *RealEstate) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	if mspID == landRegistryMSPID && ctx.GetClientIdentity().AssertAttributeValue(landRegistryAttribute, "true") == nil {
+		return nil
+	}
+
+	if err := assertReOwner(ctx, reNumber, re); err != nil {
+		return fmt.Errorf("Submitting client is neither the owner of %s nor a client of the land registry", reNumber)
+	}
+
+	return nil
+}
+
+// assertLandRegistryAdmin returns an error unless the submitting client is an
+// admin of the land registry organisation
+func assertLandRegistryAdmin(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP ID. %s", err.Error())
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client certificate. %s", err.Error())
+	}
+
+	if mspID == landRegistryMSPID && cert != nil {
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if ou == "admin" {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("Submitting client is not a %s admin", landRegistryMSPID)
+}
+
+// assertReDoesNotExist returns an error if a Real Estate is already stored under reNumber
+func assertReDoesNotExist(ctx contractapi.TransactionContextInterface, reNumber string) error {
+	reAsBytes, err := ctx.GetStub().GetState(reNumber)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if reAsBytes != nil {
+		return fmt.Errorf("%s already exists", reNumber)
+	}
 
-	reAsBytes, _ := json.Marshal(re)
+	return nil
+}
+
+// putRe stores the Real Estate as JSON under reNumber
+func putRe(ctx contractapi.TransactionContextInterface, reNumber string, re *RealEstate) error {
+	reAsBytes, err := json.Marshal(re)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s. %s", reNumber, err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(reNumber, reAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// getTxTime returns the timestamp of the transaction proposal in UTC
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to read transaction timestamp. %s", err.Error())
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+// putCompositeObject stores value as JSON under the composite key built from objectType and attributes
+func putCompositeObject(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, value interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	valueAsBytes, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s. %s", objectType, err.Error())
+	}
+
+	if err := ctx.GetStub().PutState(key, valueAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// getCompositeObject decodes the JSON stored under the composite key into value,
+// reporting whether it was found
+func getCompositeObject(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, value interface{}) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to create key. %s", err.Error())
+	}
+
+	valueAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if valueAsBytes == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(valueAsBytes, value); err != nil {
+		return false, fmt.Errorf("Failed to decode %s. %s", objectType, err.Error())
+	}
 
-	return ctx.GetStub().PutState(reNumber, reAsBytes)
+	return true, nil
 }
 
 func main() {
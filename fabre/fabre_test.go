@@ -0,0 +1,189 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// fabreTest is a test network with the contract and a client of every organisation
+type fabreTest struct {
+	*testNetwork
+	contract *SmartContract
+	alice    *testClient
+	bob      *testClient
+	carol    *testClient
+}
+
+func newFabreTest(t *testing.T) *fabreTest {
+	return &fabreTest{
+		testNetwork: newTestNetwork(t),
+		contract:    new(SmartContract),
+		alice:       newTestClient(t, "Org1MSP", "alice", "client"),
+		bob:         newTestClient(t, "Org2MSP", "bob", "client"),
+		carol:       newTestClient(t, "Org3MSP", "carol", "client"),
+	}
+}
+
+// newLandRegistryClient returns a client of mspID whose certificate carries
+// the land registry attribute with the given value
+func newLandRegistryClient(t *testing.T, mspID string, value string) *testClient {
+	t.Helper()
+
+	return newTestClientWithAttributes(t, mspID, "registrar", map[string]string{landRegistryAttribute: value}, "client")
+}
+
+// initLedger submits InitLedger
+func (f *fabreTest) initLedger() {
+	f.t.Helper()
+
+	assertNoError(f.t, f.submit(f.alice, f.contract.InitLedger))
+}
+
+// addRe adds a Real Estate of the client in Bursa priced 100000 EUR
+func (f *fabreTest) addRe(owner *testClient, reNumber string) {
+	f.t.Helper()
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AddRe(ctx, reNumber, "Bursa", 3, 1, "100000", "EUR", 95.5)
+	}))
+}
+
+// queryRe returns the committed Real Estate stored under reNumber
+func (f *fabreTest) queryRe(reNumber string) *RealEstate {
+	f.t.Helper()
+
+	var re *RealEstate
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		re, err = f.contract.QueryRe(ctx, reNumber)
+		return err
+	}))
+
+	return re
+}
+
+// putState writes a raw value to world state outside of any contract
+// transaction, as an earlier version of the chaincode would have
+func (f *fabreTest) putState(key string, value string) {
+	f.t.Helper()
+
+	f.stub.MockTransactionStart("legacy")
+	defer f.stub.MockTransactionEnd("legacy")
+
+	assertNoError(f.t, f.stub.MockStub.PutState(key, []byte(value)))
+}
+
+// resultKeys returns the key of every query result in order
+func resultKeys(results []QueryResult) []string {
+	keys := []string{}
+
+	for _, result := range results {
+		keys = append(keys, result.Key)
+	}
+
+	return keys
+}
+
+func TestNewChaincode(t *testing.T) {
+	_, err := contractapi.NewChaincode(new(SmartContract))
+	assertNoError(t, err)
+}
+
+func TestAddRe(t *testing.T) {
+	f := newFabreTest(t)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AddRe(ctx, "RE30", "Bursa", 0, 1, "99", "USD", 100)
+	})
+	assertErrorContains(t, err, "Rooms of RE30 must be greater than zero")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AddRe(ctx, "RE30", "Bursa", 3, 1, "99.999", "USD", 100)
+	})
+	assertErrorContains(t, err, `Amount "99.999" must have at most 2 decimals in USD`)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AddRe(ctx, "RE30", "Bursa", 3, 1, "99000.5", "EUR", 95.5)
+	}))
+	assertEqual(t, *f.queryRe("RE30"), RealEstate{
+		Location:    "Bursa",
+		Rooms:       3,
+		Baths:       1,
+		Price:       Money{Amount: 9900050, Currency: "EUR"},
+		LivingSpace: 95.5,
+		Owner:       "alice",
+		OwnerMSP:    f.alice.MSPID,
+		OwnerID:     f.alice.ID,
+	})
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AddRe(ctx, "RE30", "Izmir", 2, 1, "1", "USD", 50)
+	})
+	assertErrorContains(t, err, "RE30 already exists")
+	assertEqual(t, f.queryRe("RE30").OwnerID, f.alice.ID)
+}
+
+func TestChangeRePrice(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.addRe(f.alice, "RE30")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeRePrice(ctx, "RE30", "1", "GBP")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of RE30")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeRePrice(ctx, "RE0", "1", "GBP")
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of RE0")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeRePrice(ctx, "RE30", "1", "GBP")
+	}))
+	assertEqual(t, f.queryRe("RE30").Price, Money{Amount: 100, Currency: "GBP"})
+}
+
+func TestChangeReOwner(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.addRe(f.alice, "RE30")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is neither the owner of RE30 nor a client of the land registry")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID)
+	}))
+	re := f.queryRe("RE30")
+	assertEqual(t, []string{re.Owner, re.OwnerMSP, re.OwnerID}, []string{"bob", f.bob.MSPID, f.bob.ID})
+
+	// Real Estates without an owner identity only pass through the land registry
+	err = f.submit(newLandRegistryClient(t, landRegistryMSPID, "false"), func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE0", "bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is neither the owner of RE0 nor a client of the land registry")
+
+	// the CA of any organisation can issue the attribute, only the land registry's counts
+	err = f.submit(newLandRegistryClient(t, "Org2MSP", "true"), func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE0", "bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is neither the owner of RE0 nor a client of the land registry")
+
+	err = f.submit(newLandRegistryClient(t, "Org2MSP", "true"), func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "alice", f.alice.MSPID, f.alice.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is neither the owner of RE30 nor a client of the land registry")
+
+	assertNoError(t, f.submit(newLandRegistryClient(t, landRegistryMSPID, "true"), func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE0", "bob", f.bob.MSPID, f.bob.ID)
+	}))
+	assertEqual(t, f.queryRe("RE0").OwnerID, f.bob.ID)
+}
@@ -0,0 +1,538 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Leases and rent payments are stored under composite keys linked to the key
+// of the Real Estate, so they are not returned by QueryAllRes. A lease is in
+// force while it is Active and its term has not ended. Rent is due each month
+// of the term on the day of the month the lease started and is overdue from
+// the following day
+const (
+	leaseObjectType       = "lease~reNumber~leaseID"
+	rentPaymentObjectType = "rentPayment~reNumber~leaseID~period"
+	leaseStatusActive     = "Active"
+	leaseStatusEnded      = "Ended"
+	leaseDateLayout       = "2006-01-02"
+	rentPeriodLayout      = "2006-01"
+)
+
+// Lease describes the letting of a Real Estate by its owner, the landlord, to
+// a tenant for a term of whole months. Rent and deposit are in the currency of
+// the price of the Real Estate. AssigneeMSP and AssigneeID identify the owner
+// the lease is assigned to when the Real Estate is transferred
+type Lease struct {
+	LeaseID     string `json:"leaseID"`
+	ReNumber    string `json:"reNumber"`
+	LandlordMSP string `json:"landlordMSP"`
+	LandlordID  string `json:"landlordID"`
+	Tenant      string `json:"tenant"`
+	TenantMSP   string `json:"tenantMSP"`
+	TenantID    string `json:"tenantID"`
+	StartDate   string `json:"startDate"`
+	TermMonths  int    `json:"termMonths"`
+	MonthlyRent Money  `json:"monthlyRent"`
+	Deposit     Money  `json:"deposit"`
+	LeaseStatus string `json:"leaseStatus"`
+	AssigneeMSP string `json:"assigneeMSP,omitempty"`
+	AssigneeID  string `json:"assigneeID,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	EndedAt     string `json:"endedAt,omitempty"`
+}
+
+// RentPayment records the rent received for one period of a lease
+type RentPayment struct {
+	LeaseID string `json:"leaseID"`
+	Period  string `json:"period"`
+	Rent    Money  `json:"rent"`
+	PaidAt  string `json:"paidAt"`
+}
+
+// RentPeriod describes a month of the term of a lease and the rent due for it
+type RentPeriod struct {
+	Period  string `json:"period"`
+	DueDate string `json:"dueDate"`
+	Rent    Money  `json:"rent"`
+}
+
+// CreateLease lets the Real Estate with given id to a tenant from startDate,
+// given as YYYY-MM-DD on day 1 to 28 of a month, for termMonths months. Rent
+// and deposit are decimal amounts in the currency of the price of the Real
+// Estate. Only the owner may let it and only while no other lease is in force.
+// The id of the lease, the transaction id, is returned
+func (s *SmartContract) CreateLease(ctx contractapi.TransactionContextInterface, reNumber string, tenant string, tenantMSP string, tenantID string, startDate string, termMonths int, monthlyRent string, deposit string) (string, error) {
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := assertReOwner(ctx, reNumber, re); err != nil {
+		return "", err
+	}
+
+	if tenantMSP == "" || tenantID == "" {
+		return "", fmt.Errorf("Tenant MSP ID and client ID must be provided")
+	}
+
+	if tenantMSP == re.OwnerMSP && tenantID == re.OwnerID {
+		return "", fmt.Errorf("Owner cannot lease %s to itself", reNumber)
+	}
+
+	start, err := time.Parse(leaseDateLayout, startDate)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse lease start date %s. %s", startDate, err.Error())
+	}
+
+	if start.Day() > 28 {
+		return "", fmt.Errorf("Lease must start on day 1 to 28 of a month")
+	}
+
+	if termMonths <= 0 {
+		return "", fmt.Errorf("Lease term must be greater than zero")
+	}
+
+	rent, err := parseDecimalAmount(monthlyRent, re.Price.Currency)
+
+	if err != nil {
+		return "", err
+	}
+
+	depositAmount, err := parseDecimalAmount(deposit, re.Price.Currency)
+
+	if err != nil {
+		return "", err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	current, err := getLeaseInForce(ctx, reNumber, now)
+
+	if err != nil {
+		return "", err
+	}
+
+	if current != nil {
+		return "", fmt.Errorf("%s is already leased under lease %s", reNumber, current.LeaseID)
+	}
+
+	lease := Lease{
+		LeaseID:     ctx.GetStub().GetTxID(),
+		ReNumber:    reNumber,
+		LandlordMSP: re.OwnerMSP,
+		LandlordID:  re.OwnerID,
+		Tenant:      tenant,
+		TenantMSP:   tenantMSP,
+		TenantID:    tenantID,
+		StartDate:   startDate,
+		TermMonths:  termMonths,
+		MonthlyRent: Money{Amount: rent, Currency: re.Price.Currency},
+		Deposit:     Money{Amount: depositAmount, Currency: re.Price.Currency},
+		LeaseStatus: leaseStatusActive,
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+
+	if err := putCompositeObject(ctx, leaseObjectType, []string{reNumber, lease.LeaseID}, lease); err != nil {
+		return "", err
+	}
+
+	return lease.LeaseID, nil
+}
+
+// EndLease closes a lease. The tenant may end it at any time, the landlord
+// only once its term has ended
+func (s *SmartContract) EndLease(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string) error {
+	lease, err := s.QueryLease(ctx, reNumber, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	if lease.LeaseStatus != leaseStatusActive {
+		return fmt.Errorf("Lease %s of %s is already %s", leaseID, reNumber, lease.LeaseStatus)
+	}
+
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mspID == lease.TenantMSP && clientID == lease.TenantID:
+	case mspID == lease.LandlordMSP && clientID == lease.LandlordID:
+		if leaseInForce(lease, now) {
+			return fmt.Errorf("Term of lease %s of %s has not ended", leaseID, reNumber)
+		}
+	default:
+		return fmt.Errorf("Only the landlord or the tenant may end lease %s", leaseID)
+	}
+
+	lease.LeaseStatus = leaseStatusEnded
+	lease.EndedAt = now.Format(time.RFC3339)
+
+	return putCompositeObject(ctx, leaseObjectType, []string{reNumber, leaseID}, lease)
+}
+
+// AssignLease assigns a lease in force to the client the landlord is about to
+// transfer the Real Estate to. When the transfer happens the assignee becomes
+// the landlord. Assigning again replaces the assignee
+func (s *SmartContract) AssignLease(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string, assigneeMSP string, assigneeID string) error {
+	lease, err := s.QueryLease(ctx, reNumber, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertLandlord(ctx, lease); err != nil {
+		return err
+	}
+
+	if assigneeMSP == "" || assigneeID == "" {
+		return fmt.Errorf("Assignee MSP ID and client ID must be provided")
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !leaseInForce(lease, now) {
+		return fmt.Errorf("Lease %s of %s is not in force", leaseID, reNumber)
+	}
+
+	lease.AssigneeMSP = assigneeMSP
+	lease.AssigneeID = assigneeID
+
+	return putCompositeObject(ctx, leaseObjectType, []string{reNumber, leaseID}, lease)
+}
+
+// QueryLease returns the lease with given id of the Real Estate with given id
+func (s *SmartContract) QueryLease(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string) (*Lease, error) {
+	lease := new(Lease)
+
+	found, err := getCompositeObject(ctx, leaseObjectType, []string{reNumber, leaseID}, lease)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Lease %s of %s does not exist", leaseID, reNumber)
+	}
+
+	return lease, nil
+}
+
+// QueryLeases returns every lease, in force or not, of the Real Estate with given id
+func (s *SmartContract) QueryLeases(ctx contractapi.TransactionContextInterface, reNumber string) ([]Lease, error) {
+	return getLeases(ctx, reNumber)
+}
+
+// RecordRentPayment records that the landlord received the monthly rent for a
+// period of the term of the lease, given as YYYY-MM. Rent due before a lease
+// was ended can still be recorded once it has ended
+func (s *SmartContract) RecordRentPayment(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string, period string) error {
+	lease, err := s.QueryLease(ctx, reNumber, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertLandlord(ctx, lease); err != nil {
+		return err
+	}
+
+	periods, err := leasePeriods(lease)
+
+	if err != nil {
+		return err
+	}
+
+	inTerm := false
+
+	for _, rentPeriod := range periods {
+		inTerm = inTerm || rentPeriod.Period == period
+	}
+
+	if !inTerm {
+		return fmt.Errorf("%s is not a period of lease %s", period, leaseID)
+	}
+
+	payment := new(RentPayment)
+
+	found, err := getCompositeObject(ctx, rentPaymentObjectType, []string{reNumber, leaseID, period}, payment)
+
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return fmt.Errorf("Rent for %s of lease %s was already paid at %s", period, leaseID, payment.PaidAt)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	payment = &RentPayment{
+		LeaseID: leaseID,
+		Period:  period,
+		Rent:    lease.MonthlyRent,
+		PaidAt:  now.Format(time.RFC3339),
+	}
+
+	return putCompositeObject(ctx, rentPaymentObjectType, []string{reNumber, leaseID, period}, payment)
+}
+
+// QueryRentPayments returns the rent payments recorded for the lease in period order
+func (s *SmartContract) QueryRentPayments(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string) ([]RentPayment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(rentPaymentObjectType, []string{reNumber, leaseID})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	payments := []RentPayment{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		payment := RentPayment{}
+
+		if err := json.Unmarshal(queryResponse.Value, &payment); err != nil {
+			return nil, fmt.Errorf("Failed to decode rent payment. %s", err.Error())
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+// QueryOverdueRent returns the periods of the lease whose due date passed
+// before the transaction timestamp without the rent being paid. Periods due
+// from the day an ended lease was ended on are not owed
+func (s *SmartContract) QueryOverdueRent(ctx contractapi.TransactionContextInterface, reNumber string, leaseID string) ([]RentPeriod, error) {
+	lease, err := s.QueryLease(ctx, reNumber, leaseID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	periods, err := leasePeriods(lease)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.QueryRentPayments(ctx, reNumber, leaseID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paid := map[string]bool{}
+
+	for _, payment := range payments {
+		paid[payment.Period] = true
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := []RentPeriod{}
+
+	for _, period := range periods {
+		dueDate, err := time.Parse(leaseDateLayout, period.DueDate)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read due date. %s", err.Error())
+		}
+
+		if !paid[period.Period] && !now.Before(dueDate.AddDate(0, 0, 1)) {
+			overdue = append(overdue, period)
+		}
+	}
+
+	return overdue, nil
+}
+
+// transferLeases checks that the Real Estate may pass to the new owner and
+// makes the new owner the landlord of the lease in force. A Real Estate under
+// a lease in force can only pass to the owner the lease is assigned to
+func transferLeases(ctx contractapi.TransactionContextInterface, reNumber string, newOwnerMSP string, newOwnerID string) error {
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	lease, err := getLeaseInForce(ctx, reNumber, now)
+
+	if err != nil {
+		return err
+	}
+
+	if lease == nil {
+		return nil
+	}
+
+	if lease.AssigneeMSP != newOwnerMSP || lease.AssigneeID != newOwnerID {
+		return fmt.Errorf("%s is under lease %s, which is not assigned to the new owner", reNumber, lease.LeaseID)
+	}
+
+	lease.LandlordMSP = newOwnerMSP
+	lease.LandlordID = newOwnerID
+	lease.AssigneeMSP = ""
+	lease.AssigneeID = ""
+
+	return putCompositeObject(ctx, leaseObjectType, []string{reNumber, lease.LeaseID}, lease)
+}
+
+// getLeaseInForce returns the lease in force of the Real Estate, or nil if it is not leased
+func getLeaseInForce(ctx contractapi.TransactionContextInterface, reNumber string, now time.Time) (*Lease, error) {
+	leases, err := getLeases(ctx, reNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range leases {
+		if leaseInForce(&leases[i], now) {
+			return &leases[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getLeases returns every lease of the Real Estate
+func getLeases(ctx contractapi.TransactionContextInterface, reNumber string) ([]Lease, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(leaseObjectType, []string{reNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	leases := []Lease{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		lease := Lease{}
+
+		if err := json.Unmarshal(queryResponse.Value, &lease); err != nil {
+			return nil, fmt.Errorf("Failed to decode lease. %s", err.Error())
+		}
+
+		leases = append(leases, lease)
+	}
+
+	return leases, nil
+}
+
+// leaseInForce reports whether the lease is Active and its term has not ended
+// at now. A lease whose start date cannot be read is taken to be in force
+func leaseInForce(lease *Lease, now time.Time) bool {
+	if lease.LeaseStatus != leaseStatusActive {
+		return false
+	}
+
+	start, err := time.Parse(leaseDateLayout, lease.StartDate)
+
+	return err != nil || now.Before(start.AddDate(0, lease.TermMonths, 0))
+}
+
+// leasePeriods returns every period of the term of the lease in order. The
+// term of an ended lease stops at the day it was ended on
+func leasePeriods(lease *Lease) ([]RentPeriod, error) {
+	start, err := time.Parse(leaseDateLayout, lease.StartDate)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read lease start date. %s", err.Error())
+	}
+
+	end := start.AddDate(0, lease.TermMonths, 0)
+
+	if lease.EndedAt != "" {
+		endedAt, err := time.Parse(time.RFC3339, lease.EndedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read lease end time. %s", err.Error())
+		}
+
+		if endedOn := endedAt.UTC().Truncate(24 * time.Hour); endedOn.Before(end) {
+			end = endedOn
+		}
+	}
+
+	periods := []RentPeriod{}
+
+	for month := 0; month < lease.TermMonths; month++ {
+		dueDate := start.AddDate(0, month, 0)
+
+		if !dueDate.Before(end) {
+			break
+		}
+
+		periods = append(periods, RentPeriod{
+			Period:  dueDate.Format(rentPeriodLayout),
+			DueDate: dueDate.Format(leaseDateLayout),
+			Rent:    lease.MonthlyRent,
+		})
+	}
+
+	return periods, nil
+}
+
+// assertLandlord returns an error unless the submitting client is the landlord of the lease
+func assertLandlord(ctx contractapi.TransactionContextInterface, lease *Lease) error {
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if mspID != lease.LandlordMSP || clientID != lease.LandlordID {
+		return fmt.Errorf("Submitting client is not the landlord of lease %s", lease.LeaseID)
+	}
+
+	return nil
+}
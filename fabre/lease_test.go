@@ -0,0 +1,224 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// createLease lets the Real Estate of the landlord to the tenant for termMonths
+// months from startDate at 1000.50 a month and returns the lease id
+func (f *fabreTest) createLease(landlord *testClient, reNumber string, tenant *testClient, startDate string, termMonths int) string {
+	f.t.Helper()
+
+	var leaseID string
+
+	assertNoError(f.t, f.submit(landlord, func(ctx contractapi.TransactionContextInterface) (err error) {
+		leaseID, err = f.contract.CreateLease(ctx, reNumber, "tenant", tenant.MSPID, tenant.ID, startDate, termMonths, "1000.50", "2000")
+		return err
+	}))
+
+	return leaseID
+}
+
+// queryLease returns the committed lease of the Real Estate
+func (f *fabreTest) queryLease(reNumber string, leaseID string) *Lease {
+	f.t.Helper()
+
+	var lease *Lease
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		lease, err = f.contract.QueryLease(ctx, reNumber, leaseID)
+		return err
+	}))
+
+	return lease
+}
+
+// recordRentPayment records the rent of the period as received by the landlord
+func (f *fabreTest) recordRentPayment(landlord *testClient, reNumber string, leaseID string, period string) error {
+	f.t.Helper()
+
+	return f.submit(landlord, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.RecordRentPayment(ctx, reNumber, leaseID, period)
+	})
+}
+
+// overduePeriods returns the periods of the lease with overdue rent
+func (f *fabreTest) overduePeriods(reNumber string, leaseID string) []string {
+	f.t.Helper()
+
+	var overdue []RentPeriod
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		overdue, err = f.contract.QueryOverdueRent(ctx, reNumber, leaseID)
+		return err
+	}))
+
+	periods := []string{}
+
+	for _, period := range overdue {
+		periods = append(periods, period.Period)
+	}
+
+	return periods
+}
+
+func TestCreateLease(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateLease(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID, "2021-01-05", 3, "1000", "2000")
+		return err
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of RE30")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateLease(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID, "2021-01-30", 3, "1000", "2000")
+		return err
+	})
+	assertErrorContains(t, err, "Lease must start on day 1 to 28 of a month")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateLease(ctx, "RE30", "alice", f.alice.MSPID, f.alice.ID, "2021-01-05", 3, "1000", "2000")
+		return err
+	})
+	assertErrorContains(t, err, "Owner cannot lease RE30 to itself")
+
+	leaseID := f.createLease(f.alice, "RE30", f.bob, "2021-01-05", 3)
+	assertEqual(t, *f.queryLease("RE30", leaseID), Lease{
+		LeaseID:     leaseID,
+		ReNumber:    "RE30",
+		LandlordMSP: f.alice.MSPID,
+		LandlordID:  f.alice.ID,
+		Tenant:      "tenant",
+		TenantMSP:   f.bob.MSPID,
+		TenantID:    f.bob.ID,
+		StartDate:   "2021-01-05",
+		TermMonths:  3,
+		MonthlyRent: Money{Amount: 100050, Currency: "EUR"},
+		Deposit:     Money{Amount: 200000, Currency: "EUR"},
+		LeaseStatus: leaseStatusActive,
+		CreatedAt:   "2021-01-01T00:00:05Z",
+	})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.CreateLease(ctx, "RE30", "carol", f.carol.MSPID, f.carol.ID, "2021-02-05", 3, "1000", "2000")
+		return err
+	})
+	assertErrorContains(t, err, "RE30 is already leased under lease "+leaseID)
+}
+
+func TestRentPayments(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	leaseID := f.createLease(f.alice, "RE30", f.bob, "2020-12-05", 3)
+
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{"2020-12"})
+
+	assertErrorContains(t, f.recordRentPayment(f.bob, "RE30", leaseID, "2020-12"), "Submitting client is not the landlord of lease "+leaseID)
+	assertErrorContains(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2021-03"), "2021-03 is not a period of lease "+leaseID)
+
+	assertNoError(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2020-12"))
+	assertErrorContains(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2020-12"), "Rent for 2020-12 of lease "+leaseID+" was already paid at 2021-01-01T00:00:06Z")
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{})
+
+	// rent is overdue from the day after its due date
+	f.advance(4 * 24 * time.Hour)
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{})
+	f.advance(24 * time.Hour)
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{"2021-01"})
+
+	var payments []RentPayment
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		payments, err = f.contract.QueryRentPayments(ctx, "RE30", leaseID)
+		return err
+	}))
+	assertEqual(t, payments, []RentPayment{{LeaseID: leaseID, Period: "2020-12", Rent: Money{Amount: 100050, Currency: "EUR"}, PaidAt: "2021-01-01T00:00:06Z"}})
+}
+
+func TestEndLease(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	leaseID := f.createLease(f.alice, "RE30", f.bob, "2020-12-05", 6)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.EndLease(ctx, "RE30", leaseID)
+	})
+	assertErrorContains(t, err, "Term of lease "+leaseID+" of RE30 has not ended")
+
+	err = f.submit(f.carol, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.EndLease(ctx, "RE30", leaseID)
+	})
+	assertErrorContains(t, err, "Only the landlord or the tenant may end lease "+leaseID)
+
+	// the tenant leaves on the due date of 2021-02, which is no longer owed
+	f.advance(35 * 24 * time.Hour)
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.EndLease(ctx, "RE30", leaseID)
+	}))
+
+	lease := f.queryLease("RE30", leaseID)
+	assertEqual(t, []string{lease.LeaseStatus, lease.EndedAt}, []string{leaseStatusEnded, "2021-02-05T00:00:05Z"})
+
+	f.advance(90 * 24 * time.Hour)
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{"2020-12", "2021-01"})
+	assertErrorContains(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2021-02"), "2021-02 is not a period of lease "+leaseID)
+
+	// rent that fell due before the lease ended can still be recorded
+	assertNoError(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2020-12"))
+	assertNoError(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2021-01"))
+	assertEqual(t, f.overduePeriods("RE30", leaseID), []string{})
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.EndLease(ctx, "RE30", leaseID)
+	})
+	assertErrorContains(t, err, "Lease "+leaseID+" of RE30 is already Ended")
+
+	// once ended the lease no longer keeps the Real Estate from being let again
+	f.createLease(f.alice, "RE30", f.carol, "2021-06-01", 12)
+}
+
+func TestLeaseAssignmentOnTransfer(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	leaseID := f.createLease(f.alice, "RE30", f.bob, "2021-01-05", 12)
+
+	err := f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "carol", f.carol.MSPID, f.carol.ID)
+	})
+	assertErrorContains(t, err, "RE30 is under lease "+leaseID+", which is not assigned to the new owner")
+
+	offerID := f.makeReOffer(f.carol, "RE30", "90000")
+	assertErrorContains(t, f.acceptReOffer(f.alice, "RE30", offerID), "RE30 is under lease "+leaseID+", which is not assigned to the new owner")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignLease(ctx, "RE30", leaseID, f.carol.MSPID, f.carol.ID)
+	})
+	assertErrorContains(t, err, "Submitting client is not the landlord of lease "+leaseID)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignLease(ctx, "RE30", leaseID, f.carol.MSPID, f.carol.ID)
+	}))
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "which is not assigned to the new owner")
+
+	assertNoError(t, f.acceptReOffer(f.alice, "RE30", offerID))
+	assertEqual(t, f.queryRe("RE30").OwnerID, f.carol.ID)
+
+	lease := f.queryLease("RE30", leaseID)
+	assertEqual(t, []string{lease.LandlordMSP, lease.LandlordID, lease.AssigneeMSP, lease.AssigneeID}, []string{f.carol.MSPID, f.carol.ID, "", ""})
+
+	assertErrorContains(t, f.recordRentPayment(f.alice, "RE30", leaseID, "2021-01"), "Submitting client is not the landlord of lease "+leaseID)
+	assertNoError(t, f.recordRentPayment(f.carol, "RE30", leaseID, "2021-01"))
+}
@@ -0,0 +1,500 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+// This file holds the harness the contract tests run against, no peer is
+// needed. Transactions run against testStub, an in-memory ledger built on
+// shimtest.MockStub, through a contractapi.TransactionContext whose client
+// identity is read from a generated X.509 certificate. It only covers the
+// parts of the shim this contract uses.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// attributesOID is the X.509 extension the Fabric CA stores the attributes of
+// a client certificate in
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// testStub behaves like a peer where shimtest.MockStub does not. Writes are
+// buffered until the transaction commits, so reads never see writes of their
+// own transaction and failed transactions leave the ledger untouched. Range
+// queries skip composite keys. Pagination and rich queries with CouchDB
+// selectors are supported
+type testStub struct {
+	*shimtest.MockStub
+	writes map[string][]byte
+}
+
+func newTestStub(name string) *testStub {
+	stub := &testStub{MockStub: shimtest.NewMockStub(name, nil)}
+	stub.reset()
+
+	return stub
+}
+
+// reset discards the buffered writes of a transaction
+func (s *testStub) reset() {
+	s.writes = map[string][]byte{}
+}
+
+// commit applies the buffered writes of the transaction to the ledger
+func (s *testStub) commit() error {
+	keys := make([]string, 0, len(s.writes))
+
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := s.MockStub.PutState(key, s.writes[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PutState buffers the write until the transaction commits
+func (s *testStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+
+	if len(value) == 0 {
+		return s.DelState(key)
+	}
+
+	s.writes[key] = append([]byte{}, value...)
+
+	return nil
+}
+
+// DelState buffers the deletion until the transaction commits
+func (s *testStub) DelState(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+
+	s.writes[key] = nil
+
+	return nil
+}
+
+// GetStateByRange returns the committed simple keys in [startKey, endKey)
+func (s *testStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	results, err := s.rangeResults(startKey, endKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &testStateIterator{results: results}, nil
+}
+
+// GetStateByRangeWithPagination returns a page of the committed simple keys in
+// [startKey, endKey). The bookmark is the key the next page starts at
+func (s *testStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	results, err := s.rangeResults(startKey, endKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return paginate(results, pageSize, bookmark)
+}
+
+// GetQueryResultWithPagination runs a CouchDB query over the committed JSON
+// values and returns a page of the results. Only the selector is evaluated
+// and results are in key order
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	results, err := s.queryResults(query)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return paginate(results, pageSize, bookmark)
+}
+
+// rangeResults returns the committed simple keys in [startKey, endKey) in key order
+func (s *testStub) rangeResults(startKey string, endKey string) ([]*queryresult.KV, error) {
+	for _, key := range []string{startKey, endKey} {
+		if strings.HasPrefix(key, "\x00") {
+			return nil, fmt.Errorf("range query key %q is a composite key", key)
+		}
+	}
+
+	results := []*queryresult.KV{}
+
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+
+		if strings.HasPrefix(key, "\x00") || key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+
+		results = append(results, &queryresult.KV{Key: key, Value: s.State[key]})
+	}
+
+	return results, nil
+}
+
+// queryResults returns the committed keys whose JSON value matches the query
+// selector. Like CouchDB it looks at composite keys too, so a selector that
+// also matches other objects than Real Estates is caught
+func (s *testStub) queryResults(query string) ([]*queryresult.KV, error) {
+	parsed := struct {
+		Selector map[string]interface{} `json:"selector"`
+	}{}
+
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid query %s: %s", query, err.Error())
+	}
+
+	results := []*queryresult.KV{}
+
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+		document := map[string]interface{}{}
+
+		if err := json.Unmarshal(s.State[key], &document); err != nil {
+			continue
+		}
+
+		if matchesSelector(document, parsed.Selector) {
+			results = append(results, &queryresult.KV{Key: key, Value: s.State[key]})
+		}
+	}
+
+	return results, nil
+}
+
+// paginate returns the page of at most pageSize results starting at the bookmark key
+func paginate(results []*queryresult.KV, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	start := 0
+
+	if bookmark != "" {
+		start = sort.Search(len(results), func(i int) bool { return results[i].Key >= bookmark })
+	}
+
+	end := start + int(pageSize)
+
+	if end > len(results) {
+		end = len(results)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+
+	if end < len(results) {
+		metadata.Bookmark = results[end].Key
+	}
+
+	return &testStateIterator{results: results[start:end]}, metadata, nil
+}
+
+// matchesSelector evaluates the subset of CouchDB selectors SearchRes builds:
+// fields given as dotted paths compared for equality or with $gte and $lte
+func matchesSelector(document map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		value, found := lookupField(document, field)
+
+		if !found {
+			return false
+		}
+
+		operators, ok := condition.(map[string]interface{})
+
+		if !ok {
+			if !reflect.DeepEqual(value, condition) {
+				return false
+			}
+
+			continue
+		}
+
+		for operator, operand := range operators {
+			comparison, ok := compareValues(value, operand)
+
+			if !ok || (operator == "$gte" && comparison < 0) || (operator == "$lte" && comparison > 0) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// compareValues orders two numbers
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	x, ok := a.(float64)
+	y, isNumber := b.(float64)
+
+	if !ok || !isNumber {
+		return 0, false
+	}
+
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+
+	return 0, true
+}
+
+// lookupField returns the value at a dotted path of the document
+func lookupField(document map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = document
+
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[part]
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// testStateIterator iterates over a fixed list of key values
+type testStateIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (i *testStateIterator) HasNext() bool {
+	return i.next < len(i.results)
+}
+
+func (i *testStateIterator) Next() (*queryresult.KV, error) {
+	if !i.HasNext() {
+		return nil, fmt.Errorf("iterator is exhausted")
+	}
+
+	i.next++
+
+	return i.results[i.next-1], nil
+}
+
+func (i *testStateIterator) Close() error {
+	return nil
+}
+
+// testClient is a client identity transactions are submitted as
+type testClient struct {
+	MSPID   string
+	ID      string
+	creator []byte
+}
+
+// newTestClient generates a self-signed certificate with the given common
+// name and organisational units for a member of mspID
+func newTestClient(t *testing.T, mspID string, commonName string, organizationalUnits ...string) *testClient {
+	t.Helper()
+
+	return newTestClientWithAttributes(t, mspID, commonName, nil, organizationalUnits...)
+}
+
+// newTestClientWithAttributes is newTestClient with attributes added to the
+// certificate the way the Fabric CA adds them
+func newTestClientWithAttributes(t *testing.T, mspID string, commonName string, attributes map[string]string, organizationalUnits ...string) *testClient {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: organizationalUnits},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	if attributes != nil {
+		value, err := json.Marshal(map[string]map[string]string{"attrs": attributes})
+
+		if err != nil {
+			t.Fatalf("failed to marshal attributes: %v", err)
+		}
+
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: value}}
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to marshal identity: %v", err)
+	}
+
+	stub := shimtest.NewMockStub("identity", nil)
+	stub.Creator = creator
+	identity, err := cid.New(stub)
+
+	if err != nil {
+		t.Fatalf("failed to read identity: %v", err)
+	}
+
+	id, err := identity.GetID()
+
+	if err != nil {
+		t.Fatalf("failed to read client ID: %v", err)
+	}
+
+	return &testClient{MSPID: mspID, ID: id, creator: creator}
+}
+
+// testNetwork submits transactions to a testStub with a controllable clock
+type testNetwork struct {
+	t       *testing.T
+	stub    *testStub
+	clock   time.Time
+	txCount int
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	return &testNetwork{
+		t:     t,
+		stub:  newTestStub("test"),
+		clock: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// submit runs fn as a transaction of the client and commits its writes if fn
+// succeeds. The clock moves on by a second with every transaction
+func (n *testNetwork) submit(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	n.t.Helper()
+
+	return n.run(client, fn, true)
+}
+
+// evaluate runs fn as a transaction of the client without committing its
+// writes, like a query sent to a single peer
+func (n *testNetwork) evaluate(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	n.t.Helper()
+
+	return n.run(client, fn, false)
+}
+
+// advance moves the clock forward
+func (n *testNetwork) advance(d time.Duration) {
+	n.clock = n.clock.Add(d)
+}
+
+func (n *testNetwork) run(client *testClient, fn func(ctx contractapi.TransactionContextInterface) error, commit bool) error {
+	n.t.Helper()
+
+	n.txCount++
+	n.clock = n.clock.Add(time.Second)
+	txID := fmt.Sprintf("tx%04d", n.txCount)
+
+	stub := n.stub
+	stub.MockTransactionStart(txID)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: n.clock.Unix(), Nanos: int32(n.clock.Nanosecond())}
+	stub.Creator = client.creator
+
+	defer func() {
+		stub.MockTransactionEnd(txID)
+		stub.reset()
+	}()
+
+	identity, err := cid.New(stub)
+
+	if err != nil {
+		n.t.Fatalf("failed to read client identity: %v", err)
+	}
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(identity)
+
+	if err := fn(ctx); err != nil {
+		return err
+	}
+
+	if commit {
+		if err := stub.commit(); err != nil {
+			n.t.Fatalf("failed to commit %s: %v", txID, err)
+		}
+	}
+
+	return nil
+}
+
+// assertNoError fails the test if err is not nil
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// assertErrorContains fails the test unless err contains substring
+func assertErrorContains(t *testing.T, err error, substring string) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected error containing %q, got nil", substring)
+	}
+
+	if !strings.Contains(err.Error(), substring) {
+		t.Fatalf("expected error containing %q, got %q", substring, err.Error())
+	}
+}
+
+// assertEqual fails the test unless got and want are deeply equal
+func assertEqual(t *testing.T, got interface{}, want interface{}) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,454 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Purchase offers are stored under composite keys so they are not returned by
+// QueryAllRes. An offer is Open while it waits for the seller and Countered
+// while it waits for the buyer. Expired is never stored, it is reported by the
+// queries for waiting offers whose expiry has passed
+const (
+	offerObjectType       = "offer~reNumber~offerID"
+	offerStatusOpen       = "Open"
+	offerStatusCountered  = "Countered"
+	offerStatusAccepted   = "Accepted"
+	offerStatusWithdrawn  = "Withdrawn"
+	offerStatusSuperseded = "Superseded"
+	offerStatusExpired    = "Expired"
+	offerPartyBuyer       = "buyer"
+	offerPartySeller      = "seller"
+)
+
+// PurchaseOffer describes the negotiation between a buyer and the owner of a
+// Real Estate. Amount holds the terms on the table, in the currency of the
+// price of the Real Estate, and Rounds the offer and every counteroffer made
+type PurchaseOffer struct {
+	OfferID     string       `json:"offerID"`
+	ReNumber    string       `json:"reNumber"`
+	Buyer       string       `json:"buyer"`
+	BuyerMSP    string       `json:"buyerMSP"`
+	BuyerID     string       `json:"buyerID"`
+	SellerMSP   string       `json:"sellerMSP"`
+	SellerID    string       `json:"sellerID"`
+	Amount      Money        `json:"amount"`
+	OfferStatus string       `json:"offerStatus"`
+	Rounds      []OfferRound `json:"rounds"`
+	CreatedAt   string       `json:"createdAt"`
+	ExpiresAt   string       `json:"expiresAt"`
+	ClosedAt    string       `json:"closedAt,omitempty"`
+}
+
+// OfferRound records an amount put forward by the buyer or the seller
+type OfferRound struct {
+	Party  string `json:"party"`
+	Amount Money  `json:"amount"`
+	At     string `json:"at"`
+}
+
+// MakeReOffer records an offer of amount for the Real Estate with given id on
+// behalf of the submitting client. The amount is a decimal in the currency of
+// the price of the Real Estate, the offer expires validitySeconds after the
+// transaction timestamp and its id, the transaction id, is returned
+func (s *SmartContract) MakeReOffer(ctx contractapi.TransactionContextInterface, reNumber string, amount string, validitySeconds int) (string, error) {
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return "", err
+	}
+
+	if re.OwnerMSP == "" || re.OwnerID == "" {
+		return "", fmt.Errorf("%s has no identified owner to make an offer to", reNumber)
+	}
+
+	if err := assertNotTokenized(ctx, reNumber); err != nil {
+		return "", err
+	}
+
+	offered, err := parseDecimalAmount(amount, re.Price.Currency)
+
+	if err != nil {
+		return "", err
+	}
+
+	if validitySeconds <= 0 {
+		return "", fmt.Errorf("Offer validity must be greater than zero")
+	}
+
+	buyerMSP, buyerID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if buyerMSP == re.OwnerMSP && buyerID == re.OwnerID {
+		return "", fmt.Errorf("Owner cannot make an offer for %s", reNumber)
+	}
+
+	buyer, err := getSubmittingClientName(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	price := Money{Amount: offered, Currency: re.Price.Currency}
+
+	offer := PurchaseOffer{
+		OfferID:     ctx.GetStub().GetTxID(),
+		ReNumber:    reNumber,
+		Buyer:       buyer,
+		BuyerMSP:    buyerMSP,
+		BuyerID:     buyerID,
+		SellerMSP:   re.OwnerMSP,
+		SellerID:    re.OwnerID,
+		Amount:      price,
+		OfferStatus: offerStatusOpen,
+		Rounds:      []OfferRound{{Party: offerPartyBuyer, Amount: price, At: now.Format(time.RFC3339)}},
+		CreatedAt:   now.Format(time.RFC3339),
+		ExpiresAt:   now.Add(time.Duration(validitySeconds) * time.Second).Format(time.RFC3339),
+	}
+
+	if err := putCompositeObject(ctx, offerObjectType, []string{reNumber, offer.OfferID}, offer); err != nil {
+		return "", err
+	}
+
+	return offer.OfferID, nil
+}
+
+// CounterReOffer replaces the terms of an unexpired offer with a counteroffer
+// of amount, valid for validitySeconds from the transaction timestamp. The
+// seller counters an Open offer and the buyer a Countered one
+func (s *SmartContract) CounterReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string, amount string, validitySeconds int) error {
+	offer, now, err := s.getWaitingReOffer(ctx, reNumber, offerID)
+
+	if err != nil {
+		return err
+	}
+
+	countered, err := parseDecimalAmount(amount, offer.Amount.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if validitySeconds <= 0 {
+		return fmt.Errorf("Offer validity must be greater than zero")
+	}
+
+	party, status := offerPartySeller, offerStatusCountered
+
+	if waitsForBuyer(offer) {
+		party, status = offerPartyBuyer, offerStatusOpen
+	}
+
+	offer.OfferStatus = status
+	offer.Amount = Money{Amount: countered, Currency: offer.Amount.Currency}
+	offer.Rounds = append(offer.Rounds, OfferRound{Party: party, Amount: offer.Amount, At: now.Format(time.RFC3339)})
+	offer.ExpiresAt = now.Add(time.Duration(validitySeconds) * time.Second).Format(time.RFC3339)
+
+	return putCompositeObject(ctx, offerObjectType, []string{reNumber, offerID}, offer)
+}
+
+// AcceptReOffer accepts the terms of an unexpired offer. The seller accepts an
+// Open offer and the buyer a Countered one. In the same transaction the deed
+// moves to the buyer, the price of the Real Estate is set to the agreed amount
+// and every other open offer for it is superseded. A lease in force has to be
+// assigned to the buyer first
+func (s *SmartContract) AcceptReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string) error {
+	offer, now, err := s.getWaitingReOffer(ctx, reNumber, offerID)
+
+	if err != nil {
+		return err
+	}
+
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return err
+	}
+
+	re.Owner = offer.Buyer
+	re.OwnerMSP = offer.BuyerMSP
+	re.OwnerID = offer.BuyerID
+	re.Price = offer.Amount
+
+	if err := transferLeases(ctx, reNumber, offer.BuyerMSP, offer.BuyerID); err != nil {
+		return err
+	}
+
+	if err := supersedeOpenReOffers(ctx, reNumber, offerID); err != nil {
+		return err
+	}
+
+	offer.OfferStatus = offerStatusAccepted
+	offer.ClosedAt = now.Format(time.RFC3339)
+
+	if err := putCompositeObject(ctx, offerObjectType, []string{reNumber, offerID}, offer); err != nil {
+		return err
+	}
+
+	return putRe(ctx, reNumber, re)
+}
+
+// WithdrawReOffer closes an offer that is still Open or Countered. Either the
+// buyer or the seller may withdraw it, whether it has expired or not
+func (s *SmartContract) WithdrawReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string) error {
+	offer, err := getReOffer(ctx, reNumber, offerID)
+
+	if err != nil {
+		return err
+	}
+
+	if offer.OfferStatus != offerStatusOpen && offer.OfferStatus != offerStatusCountered {
+		return fmt.Errorf("Offer %s for %s is already %s", offerID, reNumber, offer.OfferStatus)
+	}
+
+	party, err := getOfferParty(ctx, offer)
+
+	if err != nil {
+		return err
+	}
+
+	if party == "" {
+		return fmt.Errorf("Only the buyer or the seller may withdraw offer %s", offerID)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	offer.OfferStatus = offerStatusWithdrawn
+	offer.ClosedAt = now.Format(time.RFC3339)
+
+	return putCompositeObject(ctx, offerObjectType, []string{reNumber, offerID}, offer)
+}
+
+// QueryReOffer returns the offer with given id made for the Real Estate with given id
+func (s *SmartContract) QueryReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string) (*PurchaseOffer, error) {
+	offer, err := getReOffer(ctx, reNumber, offerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reportOfferExpiry(offer, now)
+
+	return offer, nil
+}
+
+// QueryReOffers returns every offer ever made for the Real Estate with given
+// id, whatever its status
+func (s *SmartContract) QueryReOffers(ctx contractapi.TransactionContextInterface, reNumber string) ([]PurchaseOffer, error) {
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(offerObjectType, []string{reNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	offers := []PurchaseOffer{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		offer := PurchaseOffer{}
+
+		if err := json.Unmarshal(queryResponse.Value, &offer); err != nil {
+			return nil, fmt.Errorf("Failed to decode offer. %s", err.Error())
+		}
+
+		reportOfferExpiry(&offer, now)
+
+		offers = append(offers, offer)
+	}
+
+	return offers, nil
+}
+
+// getWaitingReOffer returns an unexpired offer waiting for the submitting
+// client, together with the transaction timestamp. The seller it was made to
+// must still own the Real Estate
+func (s *SmartContract) getWaitingReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string) (*PurchaseOffer, time.Time, error) {
+	offer, err := getReOffer(ctx, reNumber, offerID)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if offer.OfferStatus != offerStatusOpen && offer.OfferStatus != offerStatusCountered {
+		return nil, time.Time{}, fmt.Errorf("Offer %s for %s is already %s", offerID, reNumber, offer.OfferStatus)
+	}
+
+	party, err := getOfferParty(ctx, offer)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if waitsForBuyer(offer) && party != offerPartyBuyer {
+		return nil, time.Time{}, fmt.Errorf("Offer %s for %s is waiting for the buyer", offerID, reNumber)
+	}
+
+	if !waitsForBuyer(offer) && party != offerPartySeller {
+		return nil, time.Time{}, fmt.Errorf("Offer %s for %s is waiting for the seller", offerID, reNumber)
+	}
+
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, offer.ExpiresAt)
+
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Failed to read offer expiry. %s", err.Error())
+	}
+
+	if !now.Before(expiresAt) {
+		return nil, time.Time{}, fmt.Errorf("Offer %s for %s expired at %s", offerID, reNumber, offer.ExpiresAt)
+	}
+
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if re.OwnerMSP != offer.SellerMSP || re.OwnerID != offer.SellerID {
+		return nil, time.Time{}, fmt.Errorf("Offer %s was made to a previous owner of %s", offerID, reNumber)
+	}
+
+	return offer, now, nil
+}
+
+// getReOffer returns the offer as stored in world state
+func getReOffer(ctx contractapi.TransactionContextInterface, reNumber string, offerID string) (*PurchaseOffer, error) {
+	offer := new(PurchaseOffer)
+
+	found, err := getCompositeObject(ctx, offerObjectType, []string{reNumber, offerID}, offer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Offer %s for %s does not exist", offerID, reNumber)
+	}
+
+	return offer, nil
+}
+
+// getOfferParty returns whether the submitting client is the buyer or the
+// seller of the offer, or an empty string if it is neither
+func getOfferParty(ctx contractapi.TransactionContextInterface, offer *PurchaseOffer) (string, error) {
+	mspID, clientID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if mspID == offer.BuyerMSP && clientID == offer.BuyerID {
+		return offerPartyBuyer, nil
+	}
+
+	if mspID == offer.SellerMSP && clientID == offer.SellerID {
+		return offerPartySeller, nil
+	}
+
+	return "", nil
+}
+
+// waitsForBuyer reports whether the buyer has to respond to the offer
+func waitsForBuyer(offer *PurchaseOffer) bool {
+	return offer.OfferStatus == offerStatusCountered
+}
+
+// reportOfferExpiry sets the status of a waiting offer whose expiry has passed to Expired
+func reportOfferExpiry(offer *PurchaseOffer, now time.Time) {
+	if offer.OfferStatus != offerStatusOpen && offer.OfferStatus != offerStatusCountered {
+		return
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, offer.ExpiresAt)
+
+	if err == nil && !now.Before(expiresAt) {
+		offer.OfferStatus = offerStatusExpired
+	}
+}
+
+// supersedeOpenReOffers closes every Open or Countered offer for the Real
+// Estate, except the one with id exceptOfferID, as Superseded
+func supersedeOpenReOffers(ctx contractapi.TransactionContextInterface, reNumber string, exceptOfferID string) error {
+	now, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(offerObjectType, []string{reNumber})
+
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return err
+		}
+
+		offer := PurchaseOffer{}
+
+		if err := json.Unmarshal(queryResponse.Value, &offer); err != nil {
+			return fmt.Errorf("Failed to decode offer. %s", err.Error())
+		}
+
+		if offer.OfferID == exceptOfferID || (offer.OfferStatus != offerStatusOpen && offer.OfferStatus != offerStatusCountered) {
+			continue
+		}
+
+		offer.OfferStatus = offerStatusSuperseded
+		offer.ClosedAt = now.Format(time.RFC3339)
+
+		if err := putCompositeObject(ctx, offerObjectType, []string{reNumber, offer.OfferID}, offer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
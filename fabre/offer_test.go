@@ -0,0 +1,194 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// makeReOffer makes an offer of the buyer valid for an hour and returns its id
+func (f *fabreTest) makeReOffer(buyer *testClient, reNumber string, amount string) string {
+	f.t.Helper()
+
+	var offerID string
+
+	assertNoError(f.t, f.submit(buyer, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offerID, err = f.contract.MakeReOffer(ctx, reNumber, amount, 3600)
+		return err
+	}))
+
+	return offerID
+}
+
+// counterReOffer puts forward amount on the offer, valid for an hour
+func (f *fabreTest) counterReOffer(party *testClient, reNumber string, offerID string, amount string) error {
+	f.t.Helper()
+
+	return f.submit(party, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.CounterReOffer(ctx, reNumber, offerID, amount, 3600)
+	})
+}
+
+// acceptReOffer accepts the terms on the table of the offer
+func (f *fabreTest) acceptReOffer(party *testClient, reNumber string, offerID string) error {
+	f.t.Helper()
+
+	return f.submit(party, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AcceptReOffer(ctx, reNumber, offerID)
+	})
+}
+
+// offerStatuses returns the status of every offer made for the Real Estate by offer id
+func (f *fabreTest) offerStatuses(reNumber string) map[string]string {
+	f.t.Helper()
+
+	var offers []PurchaseOffer
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offers, err = f.contract.QueryReOffers(ctx, reNumber)
+		return err
+	}))
+
+	statuses := map[string]string{}
+
+	for _, offer := range offers {
+		statuses[offer.OfferID] = offer.OfferStatus
+	}
+
+	return statuses
+}
+
+func TestMakeReOffer(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.addRe(f.alice, "RE30")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeReOffer(ctx, "RE0", "1", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "RE0 has no identified owner to make an offer to")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeReOffer(ctx, "RE30", "1", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "Owner cannot make an offer for RE30")
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeReOffer(ctx, "RE30", "1", 0)
+		return err
+	})
+	assertErrorContains(t, err, "Offer validity must be greater than zero")
+
+	offerID := f.makeReOffer(f.bob, "RE30", "90000")
+
+	var offer *PurchaseOffer
+
+	assertNoError(t, f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offer, err = f.contract.QueryReOffer(ctx, "RE30", offerID)
+		return err
+	}))
+	assertEqual(t, *offer, PurchaseOffer{
+		OfferID:     offerID,
+		ReNumber:    "RE30",
+		Buyer:       "bob",
+		BuyerMSP:    f.bob.MSPID,
+		BuyerID:     f.bob.ID,
+		SellerMSP:   f.alice.MSPID,
+		SellerID:    f.alice.ID,
+		Amount:      Money{Amount: 9000000, Currency: "EUR"},
+		OfferStatus: offerStatusOpen,
+		Rounds:      []OfferRound{{Party: offerPartyBuyer, Amount: Money{Amount: 9000000, Currency: "EUR"}, At: "2021-01-01T00:00:06Z"}},
+		CreatedAt:   "2021-01-01T00:00:06Z",
+		ExpiresAt:   "2021-01-01T01:00:06Z",
+	})
+}
+
+func TestReOfferTurnTaking(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	offerID := f.makeReOffer(f.bob, "RE30", "90000")
+
+	assertErrorContains(t, f.acceptReOffer(f.bob, "RE30", offerID), "Offer "+offerID+" for RE30 is waiting for the seller")
+	assertErrorContains(t, f.counterReOffer(f.bob, "RE30", offerID, "91000"), "Offer "+offerID+" for RE30 is waiting for the seller")
+	assertErrorContains(t, f.acceptReOffer(f.carol, "RE30", offerID), "Offer "+offerID+" for RE30 is waiting for the seller")
+
+	assertNoError(t, f.counterReOffer(f.alice, "RE30", offerID, "95000"))
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{offerID: offerStatusCountered})
+	assertErrorContains(t, f.acceptReOffer(f.alice, "RE30", offerID), "Offer "+offerID+" for RE30 is waiting for the buyer")
+
+	assertNoError(t, f.counterReOffer(f.bob, "RE30", offerID, "92500.50"))
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{offerID: offerStatusOpen})
+
+	assertNoError(t, f.counterReOffer(f.alice, "RE30", offerID, "94000"))
+	assertNoError(t, f.acceptReOffer(f.bob, "RE30", offerID))
+
+	re := f.queryRe("RE30")
+	assertEqual(t, []string{re.Owner, re.OwnerMSP, re.OwnerID}, []string{"bob", f.bob.MSPID, f.bob.ID})
+	assertEqual(t, re.Price, Money{Amount: 9400000, Currency: "EUR"})
+
+	var offer *PurchaseOffer
+
+	assertNoError(t, f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		offer, err = f.contract.QueryReOffer(ctx, "RE30", offerID)
+		return err
+	}))
+	assertEqual(t, offer.OfferStatus, offerStatusAccepted)
+	assertEqual(t, len(offer.Rounds), 4)
+	assertEqual(t, offer.Rounds[2], OfferRound{Party: offerPartyBuyer, Amount: Money{Amount: 9250050, Currency: "EUR"}, At: "2021-01-01T00:00:09Z"})
+
+	assertErrorContains(t, f.acceptReOffer(f.bob, "RE30", offerID), "Offer "+offerID+" for RE30 is already Accepted")
+}
+
+func TestReOfferExpiry(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	offerID := f.makeReOffer(f.bob, "RE30", "90000")
+
+	f.advance(time.Hour)
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{offerID: offerStatusExpired})
+	assertErrorContains(t, f.acceptReOffer(f.alice, "RE30", offerID), "Offer "+offerID+" for RE30 expired at 2021-01-01T01:00:02Z")
+	assertErrorContains(t, f.counterReOffer(f.alice, "RE30", offerID, "95000"), "expired at")
+
+	// an expired offer is still open until either party withdraws it
+	err := f.submit(f.carol, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.WithdrawReOffer(ctx, "RE30", offerID)
+	})
+	assertErrorContains(t, err, "Only the buyer or the seller may withdraw offer "+offerID)
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.WithdrawReOffer(ctx, "RE30", offerID)
+	}))
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{offerID: offerStatusWithdrawn})
+
+	err = f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.WithdrawReOffer(ctx, "RE30", offerID)
+	})
+	assertErrorContains(t, err, "Offer "+offerID+" for RE30 is already Withdrawn")
+}
+
+func TestAcceptReOfferSupersedesOtherOffers(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	bobOffer := f.makeReOffer(f.bob, "RE30", "90000")
+	carolOffer := f.makeReOffer(f.carol, "RE30", "85000")
+	assertNoError(t, f.counterReOffer(f.alice, "RE30", carolOffer, "88000"))
+
+	assertNoError(t, f.acceptReOffer(f.alice, "RE30", bobOffer))
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{bobOffer: offerStatusAccepted, carolOffer: offerStatusSuperseded})
+	assertErrorContains(t, f.acceptReOffer(f.carol, "RE30", carolOffer), "Offer "+carolOffer+" for RE30 is already Superseded")
+
+	// offers made to a previous owner are superseded by any transfer
+	aliceOffer := f.makeReOffer(f.alice, "RE30", "1")
+	assertNoError(t, f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "carol", f.carol.MSPID, f.carol.ID)
+	}))
+	assertEqual(t, f.offerStatuses("RE30")[aliceOffer], offerStatusSuperseded)
+	assertErrorContains(t, f.acceptReOffer(f.bob, "RE30", aliceOffer), "is already Superseded")
+}
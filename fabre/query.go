@@ -0,0 +1,156 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Rich queries below require CouchDB as the state database. The indexes they
+// use are packaged under META-INF/statedb/couchdb/indexes and named after them
+
+// SearchRes returns a page of Real Estates priced in currency that match the
+// given criteria. Prices are decimal amounts in the currency and the living
+// space is in square metres. An empty city or maxPrice and a zero minRooms or
+// minLivingSpace leave that criterion out. Real Estates stored before their
+// fields were typed only match once migrated with MigrateRes
+func (s *SmartContract) SearchRes(ctx contractapi.TransactionContextInterface, city string, currency string, minPrice string, maxPrice string, minRooms int, minLivingSpace float64, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	selector, err := searchSelector(city, currency, minPrice, maxPrice, minRooms, minLivingSpace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := "indexPrice"
+
+	if city != "" {
+		index = "indexLocationPrice"
+	}
+
+	queryString, err := buildQueryString(selector, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// searchSelector builds the selector for SearchRes. It always constrains the
+// price, which only Real Estates carry, so no other objects in world state match
+func searchSelector(city string, currency string, minPrice string, maxPrice string, minRooms int, minLivingSpace float64) (map[string]interface{}, error) {
+	if strings.TrimSpace(currency) == "" {
+		return nil, fmt.Errorf("Currency must not be empty")
+	}
+
+	priceRange := map[string]int64{"$gte": 0}
+
+	if minPrice != "" {
+		amount, err := parseDecimalAmount(minPrice, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		priceRange["$gte"] = amount
+	}
+
+	if maxPrice != "" {
+		amount, err := parseDecimalAmount(maxPrice, currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if amount < priceRange["$gte"] {
+			return nil, fmt.Errorf("Minimum price %s is greater than maximum price %s", minPrice, maxPrice)
+		}
+
+		priceRange["$lte"] = amount
+	}
+
+	if minRooms < 0 {
+		return nil, fmt.Errorf("Minimum rooms must not be negative")
+	}
+
+	if minLivingSpace < 0 {
+		return nil, fmt.Errorf("Minimum living space must not be negative")
+	}
+
+	selector := map[string]interface{}{
+		"price.currency": currency,
+		"price.amount":   priceRange,
+	}
+
+	if city != "" {
+		selector["location"] = city
+	}
+
+	if minRooms > 0 {
+		selector["rooms"] = map[string]int{"$gte": minRooms}
+	}
+
+	if minLivingSpace > 0 {
+		selector["livingSpace"] = map[string]float64{"$gte": minLivingSpace}
+	}
+
+	return selector, nil
+}
+
+// buildQueryString marshals a CouchDB selector into a query string using the
+// named index, so values supplied by clients cannot alter the query structure
+func buildQueryString(selector map[string]interface{}, index string) (string, error) {
+	query := map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"_design/" + index + "Doc", index},
+	}
+
+	queryAsBytes, err := json.Marshal(query)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to build query. %s", err.Error())
+	}
+
+	return string(queryAsBytes), nil
+}
+
+// getQueryResultForQueryStringWithPagination runs a rich query and returns one
+// page of matching Real Estates. A record that cannot be read is returned with
+// the reason instead of failing the query
+func getQueryResultForQueryStringWithPagination(ctx contractapi.TransactionContextInterface, queryString string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []QueryResult{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		queryResult, _ := newQueryResult(queryResponse.Key, queryResponse.Value)
+		results = append(results, queryResult)
+	}
+
+	return &PaginatedQueryResult{
+		Records:             results,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
@@ -0,0 +1,74 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// searchRes returns a page of the Real Estates matching the criteria
+func (f *fabreTest) searchRes(city string, currency string, minPrice string, maxPrice string, minRooms int, minLivingSpace float64, pageSize int32, bookmark string) *PaginatedQueryResult {
+	f.t.Helper()
+
+	var page *PaginatedQueryResult
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		page, err = f.contract.SearchRes(ctx, city, currency, minPrice, maxPrice, minRooms, minLivingSpace, pageSize, bookmark)
+		return err
+	}))
+
+	return page
+}
+
+func TestSearchRes(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.putState("RE20", `{"location":"Istanbul","rooms":"2","baths":"1","price":"$55,000","livingSpace":"80m2","owner":"Agency"}`)
+	f.addRe(f.alice, "RE30")
+	f.makeReOffer(f.bob, "RE30", "100")
+
+	// the legacy RE20 and the offer on RE30 never match a search in USD
+	assertEqual(t, resultKeys(f.searchRes("Istanbul", "USD", "", "", 0, 0, 10, "").Records), []string{"RE0", "RE3", "RE5", "RE7"})
+	assertEqual(t, resultKeys(f.searchRes("", "USD", "75000", "135000", 0, 0, 10, "").Records), []string{"RE1", "RE2", "RE4", "RE6"})
+	assertEqual(t, resultKeys(f.searchRes("", "USD", "", "", 4, 150, 10, "").Records), []string{"RE4", "RE7"})
+	assertEqual(t, resultKeys(f.searchRes("", "EUR", "", "", 0, 0, 10, "").Records), []string{"RE30"})
+
+	page := f.searchRes("", "USD", "", "", 0, 0, 4, "")
+	assertEqual(t, resultKeys(page.Records), []string{"RE0", "RE1", "RE2", "RE3"})
+	page = f.searchRes("", "USD", "", "", 0, 0, 4, page.Bookmark)
+	assertEqual(t, resultKeys(page.Records), []string{"RE4", "RE5", "RE6", "RE7"})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.SearchRes(ctx, "", "USD", "10", "5", 0, 0, 4, "")
+		return err
+	})
+	assertErrorContains(t, err, "Minimum price 10 is greater than maximum price 5")
+
+	err = f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.SearchRes(ctx, "", "USD", "", "", 0, 0, 0, "")
+		return err
+	})
+	assertErrorContains(t, err, "Page size must be greater than zero")
+}
+
+func TestQueryAllRes(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.addRe(f.alice, "RE30")
+	f.makeReOffer(f.bob, "RE30", "100")
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryAllRes(ctx)
+		return err
+	}))
+
+	// offers are stored under composite keys, which the range query skips
+	assertEqual(t, resultKeys(results), []string{"RE0", "RE1", "RE2", "RE3", "RE30", "RE4", "RE5", "RE6", "RE7", "RE8"})
+	assertEqual(t, *results[4].Record, *f.queryRe("RE30"))
+}
@@ -0,0 +1,367 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The share register of a tokenized Real Estate and the balance of each holder
+// are stored under composite keys linked to the key of the Real Estate. Every
+// holding is also indexed by holder so portfolios can be read without scanning
+// all registers. The Owner of a tokenized Real Estate is its majority holder
+const (
+	shareRegisterObjectType = "shareRegister~reNumber"
+	shareHoldingObjectType  = "shareHolding~reNumber~holderMSP~holderID"
+	shareHolderIndexName    = "shareHolder~holderMSP~holderID~reNumber"
+)
+
+// ShareRegister describes the number of shares a Real Estate is divided into
+type ShareRegister struct {
+	ReNumber    string `json:"reNumber"`
+	TotalShares int64  `json:"totalShares"`
+}
+
+// ShareHolding describes the balance of shares of a Real Estate held by a client
+type ShareHolding struct {
+	ReNumber  string `json:"reNumber"`
+	Holder    string `json:"holder"`
+	HolderMSP string `json:"holderMSP"`
+	HolderID  string `json:"holderID"`
+	Shares    int64  `json:"shares"`
+}
+
+// CapTable lists every holder of shares of a tokenized Real Estate
+type CapTable struct {
+	ReNumber    string         `json:"reNumber"`
+	TotalShares int64          `json:"totalShares"`
+	Holdings    []ShareHolding `json:"holdings"`
+}
+
+// TokenizeRe divides the Real Estate with given id into totalShares shares,
+// all held by its owner. Only the owner may tokenize it and only once. From
+// then on it changes hands through TransferShares
+func (s *SmartContract) TokenizeRe(ctx contractapi.TransactionContextInterface, reNumber string, totalShares int64) error {
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertReOwner(ctx, reNumber, re); err != nil {
+		return err
+	}
+
+	if totalShares <= 0 {
+		return fmt.Errorf("Total shares must be greater than zero")
+	}
+
+	if err := assertNotTokenized(ctx, reNumber); err != nil {
+		return err
+	}
+
+	register := ShareRegister{ReNumber: reNumber, TotalShares: totalShares}
+
+	if err := putCompositeObject(ctx, shareRegisterObjectType, []string{reNumber}, register); err != nil {
+		return err
+	}
+
+	holding := ShareHolding{
+		ReNumber:  reNumber,
+		Holder:    re.Owner,
+		HolderMSP: re.OwnerMSP,
+		HolderID:  re.OwnerID,
+		Shares:    totalShares,
+	}
+
+	if err := putShareHolding(ctx, &holding); err != nil {
+		return err
+	}
+
+	return supersedeOpenReOffers(ctx, reNumber, "")
+}
+
+// TransferShares moves shares of a tokenized Real Estate from the submitting
+// client to a recipient. The client must hold at least that many shares. When
+// the transfer changes who holds the most shares the Real Estate passes to the
+// new majority holder, which supersedes all open purchase offers and requires
+// a lease in force to be assigned to them. On a tie the owner stays the same
+func (s *SmartContract) TransferShares(ctx contractapi.TransactionContextInterface, reNumber string, recipient string, recipientMSP string, recipientID string, shares int64) error {
+	re, err := s.QueryRe(ctx, reNumber)
+
+	if err != nil {
+		return err
+	}
+
+	found, err := getCompositeObject(ctx, shareRegisterObjectType, []string{reNumber}, new(ShareRegister))
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("%s is not tokenized", reNumber)
+	}
+
+	if recipientMSP == "" || recipientID == "" {
+		return fmt.Errorf("Recipient MSP ID and client ID must be provided")
+	}
+
+	if shares <= 0 {
+		return fmt.Errorf("Shares to transfer must be greater than zero")
+	}
+
+	holderMSP, holderID, err := getSubmittingClientIdentity(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if holderMSP == recipientMSP && holderID == recipientID {
+		return fmt.Errorf("Holder cannot transfer shares of %s to itself", reNumber)
+	}
+
+	holdings, err := getShareHoldings(ctx, reNumber)
+
+	if err != nil {
+		return err
+	}
+
+	sender, receiver := -1, -1
+
+	for i, holding := range holdings {
+		if holding.HolderMSP == holderMSP && holding.HolderID == holderID {
+			sender = i
+		}
+
+		if holding.HolderMSP == recipientMSP && holding.HolderID == recipientID {
+			receiver = i
+		}
+	}
+
+	balance := int64(0)
+
+	if sender >= 0 {
+		balance = holdings[sender].Shares
+	}
+
+	if balance < shares {
+		return fmt.Errorf("Submitting client holds %d shares of %s, fewer than %d", balance, reNumber, shares)
+	}
+
+	if receiver < 0 {
+		holdings = append(holdings, ShareHolding{ReNumber: reNumber, HolderMSP: recipientMSP, HolderID: recipientID})
+		receiver = len(holdings) - 1
+	}
+
+	holdings[sender].Shares -= shares
+	holdings[receiver].Shares += shares
+	holdings[receiver].Holder = recipient
+
+	if holdings[sender].Shares == 0 {
+		if err := deleteShareHolding(ctx, &holdings[sender]); err != nil {
+			return err
+		}
+	} else if err := putShareHolding(ctx, &holdings[sender]); err != nil {
+		return err
+	}
+
+	if err := putShareHolding(ctx, &holdings[receiver]); err != nil {
+		return err
+	}
+
+	majority := majorityHolder(holdings, re)
+
+	if majority.HolderMSP == re.OwnerMSP && majority.HolderID == re.OwnerID {
+		return nil
+	}
+
+	if err := transferLeases(ctx, reNumber, majority.HolderMSP, majority.HolderID); err != nil {
+		return err
+	}
+
+	if err := supersedeOpenReOffers(ctx, reNumber, ""); err != nil {
+		return err
+	}
+
+	re.Owner = majority.Holder
+	re.OwnerMSP = majority.HolderMSP
+	re.OwnerID = majority.HolderID
+
+	return putRe(ctx, reNumber, re)
+}
+
+// QueryCapTable returns the share register of the tokenized Real Estate with
+// given id together with the balance of every holder
+func (s *SmartContract) QueryCapTable(ctx contractapi.TransactionContextInterface, reNumber string) (*CapTable, error) {
+	register := new(ShareRegister)
+
+	found, err := getCompositeObject(ctx, shareRegisterObjectType, []string{reNumber}, register)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s is not tokenized", reNumber)
+	}
+
+	holdings, err := getShareHoldings(ctx, reNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CapTable{ReNumber: reNumber, TotalShares: register.TotalShares, Holdings: holdings}, nil
+}
+
+// QueryPortfolio returns the shares of every tokenized Real Estate held by the given client
+func (s *SmartContract) QueryPortfolio(ctx contractapi.TransactionContextInterface, holderMSP string, holderID string) ([]ShareHolding, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(shareHolderIndexName, []string{holderMSP, holderID})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	holdings := []ShareHolding{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to split index key. %s", err.Error())
+		}
+
+		holding := ShareHolding{}
+
+		found, err := getCompositeObject(ctx, shareHoldingObjectType, []string{keyParts[len(keyParts)-1], holderMSP, holderID}, &holding)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			holdings = append(holdings, holding)
+		}
+	}
+
+	return holdings, nil
+}
+
+// assertNotTokenized returns an error if the Real Estate has a share register,
+// as a tokenized Real Estate only changes hands through TransferShares
+func assertNotTokenized(ctx contractapi.TransactionContextInterface, reNumber string) error {
+	found, err := getCompositeObject(ctx, shareRegisterObjectType, []string{reNumber}, new(ShareRegister))
+
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return fmt.Errorf("%s is tokenized, its shares are transferred with TransferShares", reNumber)
+	}
+
+	return nil
+}
+
+// majorityHolder returns the holding with the most shares. When several
+// holdings share the most, the one of the current owner wins if it is among
+// them and otherwise the first one listed
+func majorityHolder(holdings []ShareHolding, re *RealEstate) ShareHolding {
+	var majority ShareHolding
+
+	for _, holding := range holdings {
+		isOwner := holding.HolderMSP == re.OwnerMSP && holding.HolderID == re.OwnerID
+
+		if holding.Shares > majority.Shares || (holding.Shares == majority.Shares && isOwner) {
+			majority = holding
+		}
+	}
+
+	return majority
+}
+
+// getShareHoldings returns the balance of every holder of shares of the Real Estate
+func getShareHoldings(ctx contractapi.TransactionContextInterface, reNumber string) ([]ShareHolding, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(shareHoldingObjectType, []string{reNumber})
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	holdings := []ShareHolding{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		holding := ShareHolding{}
+
+		if err := json.Unmarshal(queryResponse.Value, &holding); err != nil {
+			return nil, fmt.Errorf("Failed to decode share holding. %s", err.Error())
+		}
+
+		holdings = append(holdings, holding)
+	}
+
+	return holdings, nil
+}
+
+// putShareHolding stores a holding and its holder index entry
+func putShareHolding(ctx contractapi.TransactionContextInterface, holding *ShareHolding) error {
+	if err := putCompositeObject(ctx, shareHoldingObjectType, []string{holding.ReNumber, holding.HolderMSP, holding.HolderID}, holding); err != nil {
+		return err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(shareHolderIndexName, []string{holding.HolderMSP, holding.HolderID, holding.ReNumber})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create index key. %s", err.Error())
+	}
+
+	// only the key is needed, a value is stored because an empty value deletes the key
+	if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("Failed to put index to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// deleteShareHolding removes a holding that has no shares left and its holder index entry
+func deleteShareHolding(ctx contractapi.TransactionContextInterface, holding *ShareHolding) error {
+	for _, key := range []struct {
+		objectType string
+		attributes []string
+	}{
+		{shareHoldingObjectType, []string{holding.ReNumber, holding.HolderMSP, holding.HolderID}},
+		{shareHolderIndexName, []string{holding.HolderMSP, holding.HolderID, holding.ReNumber}},
+	} {
+		compositeKey, err := ctx.GetStub().CreateCompositeKey(key.objectType, key.attributes)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create key. %s", err.Error())
+		}
+
+		if err := ctx.GetStub().DelState(compositeKey); err != nil {
+			return fmt.Errorf("Failed to delete from world state. %s", err.Error())
+		}
+	}
+
+	return nil
+}
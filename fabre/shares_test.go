@@ -0,0 +1,203 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// tokenizeRe divides the Real Estate of the owner into totalShares shares
+func (f *fabreTest) tokenizeRe(owner *testClient, reNumber string, totalShares int64) {
+	f.t.Helper()
+
+	assertNoError(f.t, f.submit(owner, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.TokenizeRe(ctx, reNumber, totalShares)
+	}))
+}
+
+// transferShares moves shares of the Real Estate from the holder to the recipient
+func (f *fabreTest) transferShares(holder *testClient, reNumber string, recipient *testClient, shares int64) error {
+	f.t.Helper()
+
+	return f.submit(holder, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.TransferShares(ctx, reNumber, "holder", recipient.MSPID, recipient.ID, shares)
+	})
+}
+
+// shareBalances returns the shares of the Real Estate held by each of the clients
+func (f *fabreTest) shareBalances(reNumber string, holders ...*testClient) []int64 {
+	f.t.Helper()
+
+	var capTable *CapTable
+
+	assertNoError(f.t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		capTable, err = f.contract.QueryCapTable(ctx, reNumber)
+		return err
+	}))
+
+	balances := []int64{}
+
+	for _, holder := range holders {
+		balance := int64(0)
+
+		for _, holding := range capTable.Holdings {
+			if holding.HolderMSP == holder.MSPID && holding.HolderID == holder.ID {
+				balance = holding.Shares
+			}
+		}
+
+		balances = append(balances, balance)
+	}
+
+	return balances
+}
+
+func TestTokenizeRe(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	offerID := f.makeReOffer(f.bob, "RE30", "90000")
+
+	err := f.submit(f.bob, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.TokenizeRe(ctx, "RE30", 100)
+	})
+	assertErrorContains(t, err, "Submitting client is not the owner of RE30")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.TokenizeRe(ctx, "RE30", 0)
+	})
+	assertErrorContains(t, err, "Total shares must be greater than zero")
+
+	f.tokenizeRe(f.alice, "RE30", 100)
+	assertEqual(t, f.offerStatuses("RE30"), map[string]string{offerID: offerStatusSuperseded})
+
+	var capTable *CapTable
+
+	assertNoError(t, f.evaluate(f.bob, func(ctx contractapi.TransactionContextInterface) (err error) {
+		capTable, err = f.contract.QueryCapTable(ctx, "RE30")
+		return err
+	}))
+	assertEqual(t, *capTable, CapTable{
+		ReNumber:    "RE30",
+		TotalShares: 100,
+		Holdings:    []ShareHolding{{ReNumber: "RE30", Holder: "alice", HolderMSP: f.alice.MSPID, HolderID: f.alice.ID, Shares: 100}},
+	})
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.TokenizeRe(ctx, "RE30", 10)
+	})
+	assertErrorContains(t, err, "RE30 is tokenized, its shares are transferred with TransferShares")
+
+	err = f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.ChangeReOwner(ctx, "RE30", "bob", f.bob.MSPID, f.bob.ID)
+	})
+	assertErrorContains(t, err, "RE30 is tokenized, its shares are transferred with TransferShares")
+}
+
+func TestTransferShares(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+
+	assertErrorContains(t, f.transferShares(f.alice, "RE30", f.bob, 1), "RE30 is not tokenized")
+
+	f.tokenizeRe(f.alice, "RE30", 100)
+
+	assertErrorContains(t, f.transferShares(f.bob, "RE30", f.alice, 1), "Submitting client holds 0 shares of RE30, fewer than 1")
+	assertErrorContains(t, f.transferShares(f.alice, "RE30", f.bob, 101), "Submitting client holds 100 shares of RE30, fewer than 101")
+	assertErrorContains(t, f.transferShares(f.alice, "RE30", f.bob, 0), "Shares to transfer must be greater than zero")
+	assertErrorContains(t, f.transferShares(f.alice, "RE30", f.alice, 1), "Holder cannot transfer shares of RE30 to itself")
+
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.bob, 30))
+	assertNoError(t, f.transferShares(f.bob, "RE30", f.carol, 10))
+	assertEqual(t, f.shareBalances("RE30", f.alice, f.bob, f.carol), []int64{70, 20, 10})
+
+	// a holder that transfers all its shares leaves the cap table
+	assertNoError(t, f.transferShares(f.carol, "RE30", f.bob, 10))
+
+	var capTable *CapTable
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		capTable, err = f.contract.QueryCapTable(ctx, "RE30")
+		return err
+	}))
+	assertEqual(t, len(capTable.Holdings), 2)
+	assertEqual(t, f.shareBalances("RE30", f.alice, f.bob), []int64{70, 30})
+}
+
+func TestTransferSharesChangesMajorityHolder(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	f.tokenizeRe(f.alice, "RE30", 100)
+
+	// on a tie the owner stays the same
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.bob, 50))
+	assertEqual(t, f.queryRe("RE30").OwnerID, f.alice.ID)
+
+	err := f.submit(f.carol, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.MakeReOffer(ctx, "RE30", "90000", 3600)
+		return err
+	})
+	assertErrorContains(t, err, "RE30 is tokenized, its shares are transferred with TransferShares")
+
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.carol, 10))
+	re := f.queryRe("RE30")
+	assertEqual(t, []string{re.Owner, re.OwnerMSP, re.OwnerID}, []string{"holder", f.bob.MSPID, f.bob.ID})
+
+	// transfers that leave the majority holder in place keep the owner
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.carol, 30))
+	assertEqual(t, f.queryRe("RE30").OwnerID, f.bob.ID)
+	assertEqual(t, f.shareBalances("RE30", f.alice, f.bob, f.carol), []int64{10, 50, 40})
+}
+
+func TestTransferSharesOfLeasedRe(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	f.tokenizeRe(f.alice, "RE30", 100)
+	leaseID := f.createLease(f.alice, "RE30", f.carol, "2021-01-05", 12)
+
+	// shares change hands freely as long as the majority holder stays
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.bob, 40))
+	assertErrorContains(t, f.transferShares(f.alice, "RE30", f.bob, 20), "RE30 is under lease "+leaseID+", which is not assigned to the new owner")
+
+	assertNoError(t, f.submit(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		return f.contract.AssignLease(ctx, "RE30", leaseID, f.bob.MSPID, f.bob.ID)
+	}))
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.bob, 20))
+	assertEqual(t, f.queryRe("RE30").OwnerID, f.bob.ID)
+
+	lease := f.queryLease("RE30", leaseID)
+	assertEqual(t, []string{lease.LandlordID, lease.AssigneeID}, []string{f.bob.ID, ""})
+}
+
+func TestQueryPortfolio(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	f.addRe(f.alice, "RE31")
+	f.tokenizeRe(f.alice, "RE30", 100)
+	f.tokenizeRe(f.alice, "RE31", 10)
+	assertNoError(t, f.transferShares(f.alice, "RE30", f.bob, 100))
+	assertNoError(t, f.transferShares(f.alice, "RE31", f.bob, 4))
+
+	portfolio := func(holder *testClient) []ShareHolding {
+		var holdings []ShareHolding
+
+		assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+			holdings, err = f.contract.QueryPortfolio(ctx, holder.MSPID, holder.ID)
+			return err
+		}))
+
+		return holdings
+	}
+
+	assertEqual(t, portfolio(f.alice), []ShareHolding{
+		{ReNumber: "RE31", Holder: "alice", HolderMSP: f.alice.MSPID, HolderID: f.alice.ID, Shares: 6},
+	})
+	assertEqual(t, portfolio(f.bob), []ShareHolding{
+		{ReNumber: "RE30", Holder: "holder", HolderMSP: f.bob.MSPID, HolderID: f.bob.ID, Shares: 100},
+		{ReNumber: "RE31", Holder: "holder", HolderMSP: f.bob.MSPID, HolderID: f.bob.ID, Shares: 4},
+	})
+	assertEqual(t, portfolio(f.carol), []ShareHolding{})
+}
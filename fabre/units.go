@@ -0,0 +1,298 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// currencyMinorUnits lists the ISO 4217 currencies prices may be given in
+// with the number of digits of their minor unit
+var currencyMinorUnits = map[string]int{
+	"EUR": 2,
+	"GBP": 2,
+	"TRY": 2,
+	"USD": 2,
+}
+
+// legacyCurrencySymbols maps the currency symbols and codes used in prices
+// stored as strings, such as "$140,000", to their ISO 4217 code. It is a slice
+// so that every peer tries them in the same order
+var legacyCurrencySymbols = []struct {
+	symbol string
+	code   string
+}{
+	{"$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"₺", "TRY"},
+	{"TL", "TRY"},
+	{"EUR", "EUR"},
+	{"GBP", "GBP"},
+	{"TRY", "TRY"},
+	{"USD", "USD"},
+}
+
+// legacyAreaUnits are the square metre suffixes of living spaces stored as
+// strings, such as "120m2"
+var legacyAreaUnits = []string{"m2", "m²", "sqm"}
+
+// Money is an amount in the minor unit of an ISO 4217 currency, e.g. cents
+// for USD, so that decimal prices are exact
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// legacyRealEstate is a Real Estate as stored before its numeric fields were typed
+type legacyRealEstate struct {
+	Location    string `json:"location"`
+	Rooms       string `json:"rooms"`
+	Baths       string `json:"baths"`
+	Price       string `json:"price"`
+	LivingSpace string `json:"livingSpace"`
+	Owner       string `json:"owner"`
+}
+
+// MigrationResult structure used for handling a page of migrated Real Estates.
+// Failed lists the records of the page that cannot be read with the reason
+type MigrationResult struct {
+	Migrated            int32         `json:"migrated"`
+	Failed              []QueryResult `json:"failed"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// MigrateRes rewrites the Real Estates stored with string fields on a page of
+// at most pageSize records starting at bookmark with typed fields, together
+// with the bookmark of the next page. Records that cannot be read are left as
+// they are and reported, so the migration still moves on to the next page.
+// Only admins of the land registry organisation may migrate Real Estates
+func (s *SmartContract) MigrateRes(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	if err := assertLandRegistryAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than zero")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{Failed: []QueryResult{}}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		queryResult, legacy := newQueryResult(queryResponse.Key, queryResponse.Value)
+
+		if queryResult.Record == nil {
+			result.Failed = append(result.Failed, queryResult)
+			continue
+		}
+
+		if !legacy {
+			continue
+		}
+
+		if err := putRe(ctx, queryResponse.Key, queryResult.Record); err != nil {
+			return nil, err
+		}
+
+		result.Migrated++
+	}
+
+	result.FetchedRecordsCount = responseMetadata.FetchedRecordsCount
+	result.Bookmark = responseMetadata.Bookmark
+
+	return result, nil
+}
+
+// decodeRe decodes a Real Estate stored under reNumber. Records stored with
+// string fields are parsed into typed fields and reported as legacy
+func decodeRe(reNumber string, reAsBytes []byte) (*RealEstate, bool, error) {
+	re := new(RealEstate)
+	err := json.Unmarshal(reAsBytes, re)
+
+	if err == nil {
+		return re, false, nil
+	}
+
+	typeErr := new(json.UnmarshalTypeError)
+
+	if !errors.As(err, &typeErr) {
+		return nil, false, fmt.Errorf("Failed to decode %s. %s", reNumber, err.Error())
+	}
+
+	legacy := legacyRealEstate{}
+
+	if err := json.Unmarshal(reAsBytes, &legacy); err != nil {
+		return nil, false, fmt.Errorf("Failed to decode %s. %s", reNumber, err.Error())
+	}
+
+	re, err = parseLegacyRe(legacy)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to parse %s. %s", reNumber, err.Error())
+	}
+
+	return re, true, nil
+}
+
+// parseLegacyRe parses the string fields of a Real Estate written by InitLedger
+// or AddRe before its numeric fields were typed
+func parseLegacyRe(legacy legacyRealEstate) (*RealEstate, error) {
+	rooms, err := strconv.Atoi(strings.TrimSpace(legacy.Rooms))
+
+	if err != nil {
+		return nil, fmt.Errorf("rooms %q is not a whole number", legacy.Rooms)
+	}
+
+	baths, err := strconv.Atoi(strings.TrimSpace(legacy.Baths))
+
+	if err != nil {
+		return nil, fmt.Errorf("baths %q is not a whole number", legacy.Baths)
+	}
+
+	price, err := parseLegacyPrice(legacy.Price)
+
+	if err != nil {
+		return nil, err
+	}
+
+	livingSpace, err := parseLegacyArea(legacy.LivingSpace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RealEstate{
+		Location:    legacy.Location,
+		Rooms:       rooms,
+		Baths:       baths,
+		Price:       price,
+		LivingSpace: livingSpace,
+		Owner:       legacy.Owner,
+	}, nil
+}
+
+// parseLegacyPrice parses a price such as "$1,135,500" or "75000.50 EUR" with
+// a currency symbol or ISO 4217 code and comma thousands separators
+func parseLegacyPrice(price string) (Money, error) {
+	value := strings.TrimSpace(price)
+	currency := ""
+
+	for _, legacy := range legacyCurrencySymbols {
+		if strings.HasPrefix(value, legacy.symbol) || strings.HasSuffix(value, legacy.symbol) {
+			value = strings.TrimSuffix(strings.TrimPrefix(value, legacy.symbol), legacy.symbol)
+			currency = legacy.code
+			break
+		}
+	}
+
+	if currency == "" {
+		return Money{}, fmt.Errorf("price %q has no known currency", price)
+	}
+
+	amount, err := parseDecimalAmount(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// parseLegacyArea parses a living space such as "120m2" into square metres
+func parseLegacyArea(area string) (float64, error) {
+	value := strings.ToLower(strings.TrimSpace(area))
+
+	for _, unit := range legacyAreaUnits {
+		value = strings.TrimSuffix(value, unit)
+	}
+
+	squareMetres, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("living space %q is not an area in square metres", area)
+	}
+
+	return squareMetres, nil
+}
+
+// parseDecimalAmount converts a non-negative decimal amount such as 140000.50
+// to the minor unit of the currency without rounding
+func parseDecimalAmount(value string, currency string) (int64, error) {
+	minorUnits, ok := currencyMinorUnits[currency]
+
+	if !ok {
+		return 0, fmt.Errorf("Currency %q is not a supported ISO 4217 code", currency)
+	}
+
+	parts := strings.Split(strings.TrimSpace(value), ".")
+	fraction := ""
+
+	if len(parts) == 2 {
+		fraction = parts[1]
+
+		if !isDigits(fraction) || len(fraction) > minorUnits {
+			return 0, fmt.Errorf("Amount %q must have at most %d decimals in %s", value, minorUnits, currency)
+		}
+	}
+
+	if len(parts) > 2 || !isDigits(parts[0]) {
+		return 0, fmt.Errorf("Amount %q is not a decimal number", value)
+	}
+
+	fraction += strings.Repeat("0", minorUnits-len(fraction))
+	amount, err := strconv.ParseInt(parts[0]+fraction, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("Amount %q is out of range", value)
+	}
+
+	return amount, nil
+}
+
+// moneyFromWholeUnits converts an amount in whole units of the currency to Money
+func moneyFromWholeUnits(units int64, currency string) Money {
+	amount := units
+
+	for i := 0; i < currencyMinorUnits[currency]; i++ {
+		amount *= 10
+	}
+
+	return Money{Amount: amount, Currency: currency}
+}
+
+// isDigits reports whether value is a non-empty string of decimal digits
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
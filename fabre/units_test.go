@@ -0,0 +1,168 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// unreadableRe is a Real Estate stored with string fields that cannot be parsed
+const unreadableRe = `{"location":"Izmir","rooms":"two","baths":"1","price":"$55,000","livingSpace":"80m2","owner":"Agency"}`
+
+func TestInitLedger(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+
+	assertEqual(t, *f.queryRe("RE7"), RealEstate{
+		Location:    "Istanbul",
+		Rooms:       7,
+		Baths:       3,
+		Price:       Money{Amount: 113550000, Currency: "USD"},
+		LivingSpace: 370,
+		Owner:       "Agency",
+	})
+}
+
+func TestParseLegacyPrice(t *testing.T) {
+	price, err := parseLegacyPrice("$1,135,500.5")
+	assertNoError(t, err)
+	assertEqual(t, price, Money{Amount: 113550050, Currency: "USD"})
+
+	price, err = parseLegacyPrice("75000 TL")
+	assertNoError(t, err)
+	assertEqual(t, price, Money{Amount: 7500000, Currency: "TRY"})
+
+	price, err = parseLegacyPrice("€75,000")
+	assertNoError(t, err)
+	assertEqual(t, price, Money{Amount: 7500000, Currency: "EUR"})
+
+	_, err = parseLegacyPrice("75000")
+	assertErrorContains(t, err, `price "75000" has no known currency`)
+
+	_, err = parseLegacyPrice("$75,000.505")
+	assertErrorContains(t, err, `Amount "75000.505" must have at most 2 decimals in USD`)
+}
+
+func TestParseLegacyArea(t *testing.T) {
+	area, err := parseLegacyArea("80.5 m2")
+	assertNoError(t, err)
+	assertEqual(t, area, 80.5)
+
+	area, err = parseLegacyArea("80m²")
+	assertNoError(t, err)
+	assertEqual(t, area, 80.0)
+
+	_, err = parseLegacyArea("80 sqft")
+	assertErrorContains(t, err, `living space "80 sqft" is not an area in square metres`)
+}
+
+func TestParseDecimalAmount(t *testing.T) {
+	amount, err := parseDecimalAmount("140000.5", "USD")
+	assertNoError(t, err)
+	assertEqual(t, amount, int64(14000050))
+
+	amount, err = parseDecimalAmount(" 140000 ", "TRY")
+	assertNoError(t, err)
+	assertEqual(t, amount, int64(14000000))
+
+	_, err = parseDecimalAmount("1.505", "EUR")
+	assertErrorContains(t, err, `Amount "1.505" must have at most 2 decimals in EUR`)
+
+	_, err = parseDecimalAmount("-1", "USD")
+	assertErrorContains(t, err, `Amount "-1" is not a decimal number`)
+
+	_, err = parseDecimalAmount("1.2.3", "USD")
+	assertErrorContains(t, err, `Amount "1.2.3" is not a decimal number`)
+
+	_, err = parseDecimalAmount("99999999999999999999", "USD")
+	assertErrorContains(t, err, `Amount "99999999999999999999" is out of range`)
+
+	_, err = parseDecimalAmount("1", "XYZ")
+	assertErrorContains(t, err, `Currency "XYZ" is not a supported ISO 4217 code`)
+}
+
+func TestQueryLegacyRe(t *testing.T) {
+	f := newFabreTest(t)
+	f.putState("RE20", `{"location":"Izmir","rooms":"2","baths":"1","price":"$1,135,500.5","livingSpace":"80.5 m2","owner":"Agency"}`)
+	f.putState("RE21", unreadableRe)
+
+	assertEqual(t, *f.queryRe("RE20"), RealEstate{
+		Location:    "Izmir",
+		Rooms:       2,
+		Baths:       1,
+		Price:       Money{Amount: 113550050, Currency: "USD"},
+		LivingSpace: 80.5,
+		Owner:       "Agency",
+	})
+
+	err := f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := f.contract.QueryRe(ctx, "RE21")
+		return err
+	})
+	assertErrorContains(t, err, `Failed to parse RE21. rooms "two" is not a whole number`)
+}
+
+func TestQueryAllResReportsUnreadableRecords(t *testing.T) {
+	f := newFabreTest(t)
+	f.addRe(f.alice, "RE30")
+	f.putState("RE31", unreadableRe)
+	f.putState("RE32", "not a Real Estate")
+
+	var results []QueryResult
+
+	assertNoError(t, f.evaluate(f.alice, func(ctx contractapi.TransactionContextInterface) (err error) {
+		results, err = f.contract.QueryAllRes(ctx)
+		return err
+	}))
+	assertEqual(t, resultKeys(results), []string{"RE30", "RE31", "RE32"})
+	assertEqual(t, *results[0].Record, *f.queryRe("RE30"))
+	assertEqual(t, results[1], QueryResult{Key: "RE31", Error: `Failed to parse RE31. rooms "two" is not a whole number`})
+	assertEqual(t, results[2], QueryResult{Key: "RE32", Error: "Failed to decode RE32. invalid character 'o' in literal null (expecting 'u')"})
+}
+
+func TestMigrateRes(t *testing.T) {
+	f := newFabreTest(t)
+	f.initLedger()
+	f.putState("RE20", `{"location":"Izmir","rooms":"2","baths":"1","price":"$1,135,500.5","livingSpace":"80.5 m2","owner":"Agency"}`)
+	f.putState("RE21", `{"location":"Izmir","rooms":"2","baths":"1","price":"75000 TL","livingSpace":"80m²","owner":"Agency"}`)
+	f.putState("RE22", unreadableRe)
+
+	admin := newTestClient(t, landRegistryMSPID, "admin", "admin")
+
+	for _, client := range []*testClient{f.carol, newTestClient(t, "Org2MSP", "admin", "admin")} {
+		err := f.submit(client, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := f.contract.MigrateRes(ctx, 8, "")
+			return err
+		})
+		assertErrorContains(t, err, "Submitting client is not a "+landRegistryMSPID+" admin")
+	}
+
+	migrate := func(bookmark string) *MigrationResult {
+		var result *MigrationResult
+
+		assertNoError(t, f.submit(admin, func(ctx contractapi.TransactionContextInterface) (err error) {
+			result, err = f.contract.MigrateRes(ctx, 8, bookmark)
+			return err
+		}))
+
+		return result
+	}
+
+	// the unreadable RE22 is reported and left as it is while the page moves on
+	result := migrate("")
+	assertEqual(t, *result, MigrationResult{
+		Migrated:            2,
+		Failed:              []QueryResult{{Key: "RE22", Error: `Failed to parse RE22. rooms "two" is not a whole number`}},
+		FetchedRecordsCount: 8,
+		Bookmark:            "RE5",
+	})
+	assertEqual(t, string(f.stub.State["RE21"]), `{"location":"Izmir","rooms":2,"baths":1,"price":{"amount":7500000,"currency":"TRY"},"livingSpace":80,"owner":"Agency"}`)
+	assertEqual(t, string(f.stub.State["RE22"]), unreadableRe)
+	assertEqual(t, f.queryRe("RE20").Price, Money{Amount: 113550050, Currency: "USD"})
+
+	assertEqual(t, *migrate(result.Bookmark), MigrationResult{Migrated: 0, Failed: []QueryResult{}, FetchedRecordsCount: 4})
+}
@@ -9,6 +9,19 @@ export CHANNEL_PROFILE=AllOrgsChannel # defined in configtx.yaml
 export CHANNEL_ID=allorgs # anything
 export CCURL=github.com/ataberkozek/hyperledger-fabric-v2-kubernetes-dev/fabcar/
 export CCNAME=fabcar
+# fabcar sets key-level endorsement policies of the owner and regulator orgs on
+# cars and on every key it keeps for a car: liens, sale listings and offers,
+# auctions and bids, negotiations, service records, price history and indexes.
+# This policy only applies when such a key is created, and a transaction
+# endorsed by the owner and regulator orgs alone must still satisfy it, so two
+# of the three orgs are enough
+export CC_SIGNATURE_POLICY="OutOf(2,'Org1MSP.member','Org2MSP.member','Org3MSP.member')"
+# sealed bids are kept in a private data collection of the bidder org and
+# negotiated prices in one shared by the seller and buyer orgs. Their collection
+# endorsement policies let those orgs alone endorse the private writes instead
+# of the chaincode policy. The config is read from the chaincode source fetched
+# by ccInstall
+export CC_COLLECTIONS_CONFIG="\$(go env GOPATH)/src/${CCURL}collections_config.json"
 
 createNamespaces() {
     for NS in org1 org2 org3 org4 org5
@@ -106,10 +119,12 @@ init ${CCNAME} ${CHANNEL_ID} | sh -c "kubectl --namespace org1 exec -i $(kubectl
   ;;
 
 ccChangeCarOwner)
-changeCarOwner ${CCNAME} ${CHANNEL_ID} | sh -c "kubectl --namespace org1 exec -i $(kubectl -n org1 get pod -l app=admin -o name) -- sh -"
+# usage: ./hlffabcar.sh ccChangeCarOwner CAR10 Robert Org2MSP <client ID of Robert>
+changeCarOwner ${CCNAME} ${CHANNEL_ID} $2 $3 $4 $5 | sh -c "kubectl --namespace org1 exec -i $(kubectl -n org1 get pod -l app=admin -o name) -- sh -"
   ;;
   
 ccChangeCarPrice)
+# reprices CAR10 added by ccCreateCar, as only the owner of a car may change its price
 changeCarPrice ${CCNAME} ${CHANNEL_ID} | sh -c "kubectl --namespace org1 exec -i $(kubectl -n org1 get pod -l app=admin -o name) -- sh -"
   ;;
   
@@ -117,6 +132,11 @@ ccCreateCar)
 createCar ${CCNAME} ${CHANNEL_ID} | sh -c "kubectl --namespace org1 exec -i $(kubectl -n org1 get pod -l app=admin -o name) -- sh -"
   ;;
 
+ccImportCars)
+# usage: ./hlffabcar.sh ccImportCars cars.json
+importCars ${CCNAME} ${CHANNEL_ID} $2 | sh -c "kubectl --namespace org1 exec -i $(kubectl -n org1 get pod -l app=admin -o name) -- sh -"
+  ;;
+
 ccQueryAllCars)
 for ORG in org1 org2 org3
   do
@@ -1,3 +1,8 @@
+# endorsement policy approved and committed for the chaincode, scripts may override it
+CC_SIGNATURE_POLICY=${CC_SIGNATURE_POLICY:-"AND('Org1MSP.member','Org2MSP.member','Org3MSP.member')"}
+# private data collections config file on the admin pod, scripts may set it for chaincodes using collections
+CC_COLLECTIONS_CONFIG=${CC_COLLECTIONS_CONFIG:-""}
+
 packageAndInstall() {
 CCURL=$1
 CCNAME=$2
@@ -24,7 +29,8 @@ cat <<EOF
 PACKAGE_ID=\$(peer lifecycle chaincode queryinstalled | awk '/${LABEL}/ {print substr(\$3, 1, length(\$3)-1)}')
 echo "Package ID: \${PACKAGE_ID}"
 peer lifecycle chaincode approveformyorg --package-id \${PACKAGE_ID} \
-  --signature-policy "AND('Org1MSP.member','Org2MSP.member','Org3MSP.member')" \
+  --signature-policy "${CC_SIGNATURE_POLICY}" \
+  ${CC_COLLECTIONS_CONFIG:+--collections-config ${CC_COLLECTIONS_CONFIG}} \
   -C ${CHANNEL_ID} -n ${CCNAME} -v 1.0  --sequence 1 \
   --tls true --cafile \$ORDERER_TLS_ROOTCERT_FILE --waitForEvent
 EOF
@@ -36,7 +42,8 @@ CHANNEL_ID=$2
 cat <<EOF
 peer lifecycle chaincode checkcommitreadiness \
 --name ${CCNAME} --channelID ${CHANNEL_ID} \
---signature-policy "AND('Org1MSP.member', 'Org2MSP.member', 'Org3MSP.member')" \
+--signature-policy "${CC_SIGNATURE_POLICY}" \
+${CC_COLLECTIONS_CONFIG:+--collections-config ${CC_COLLECTIONS_CONFIG}} \
 --version 1.0 --sequence 1
 EOF
 }
@@ -50,7 +57,8 @@ peer lifecycle chaincode commit \
   --channelID ${CHANNEL_ID} \
   --name ${CCNAME} \
   --version 1.0 \
-  --signature-policy "AND('Org1MSP.member','Org2MSP.member', 'Org3MSP.member')" \
+  --signature-policy "${CC_SIGNATURE_POLICY}" \
+  ${CC_COLLECTIONS_CONFIG:+--collections-config ${CC_COLLECTIONS_CONFIG}} \
   --sequence 1 --waitForEvent \
   --peerAddresses peer0.org1:7051 \
   --peerAddresses peer0.org2:7051 \
@@ -110,12 +118,17 @@ EOF
 changeCarOwner() {
 CCNAME=$1
 CHANNEL_ID=$2
+CAR_NUMBER=$3
+NEW_OWNER=$4
+NEW_OWNER_MSP=$5
+# the client ID of the new owner as returned by cid.GetID
+NEW_OWNER_ID=$6
 cat <<EOF
 echo "Submitting invoketransaction to smart contract on ${CHANNEL_ID}"
 peer chaincode invoke \
   --channelID ${CHANNEL_ID} \
   --name ${CCNAME} \
-  --ctor '{"Args":["ChangeCarOwner", "CAR1", "Robert"]}' \
+  --ctor '{"Args":["ChangeCarOwner", "${CAR_NUMBER}", "${NEW_OWNER}", "${NEW_OWNER_MSP}", "${NEW_OWNER_ID}"]}' \
   --waitForEvent \
   --waitForEventTimeout 300s \
   --cafile \$ORDERER_TLS_ROOTCERT_FILE \
@@ -137,7 +150,7 @@ echo "Submitting invoketransaction to smart contract on ${CHANNEL_ID}"
 peer chaincode invoke \
   --channelID ${CHANNEL_ID} \
   --name ${CCNAME} \
-  --ctor '{"Args":["ChangeCarPrice", "CAR1", "200000"]}' \
+  --ctor '{"Args":["ChangeCarPrice", "CAR10", "200000", "USD"]}' \
   --waitForEvent \
   --waitForEventTimeout 300s \
   --cafile \$ORDERER_TLS_ROOTCERT_FILE \
@@ -159,7 +172,38 @@ echo "Submitting invoketransaction to smart contract on ${CHANNEL_ID}"
 peer chaincode invoke \
   --channelID ${CHANNEL_ID} \
   --name ${CCNAME} \
-  --ctor '{"Args":["CreateCar", "CAR10", "Volkswagen", "Polo", "white", "Alice"]}' \
+  --ctor '{"Args":["CreateCar", "CAR10", "1M8GDM9AXKP042788", "Volkswagen", "Polo", "white", "Alice", "1500000", "EUR"]}' \
+  --waitForEvent \
+  --waitForEventTimeout 300s \
+  --cafile \$ORDERER_TLS_ROOTCERT_FILE \
+  --tls true -o orderer.org1:7050 \
+  --peerAddresses peer0.org1:7051 \
+  --peerAddresses peer0.org2:7051 \
+  --peerAddresses peer0.org3:7051  \
+  --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org1-cert.pem \
+  --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org2-cert.pem \
+  --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org3-cert.pem 
+EOF
+}
+
+importCars() {
+CCNAME=$1
+CHANNEL_ID=$2
+CARS_FILE=$3
+# the JSON array of cars is passed as a single string argument of ImportCars
+CTOR=$(jq -c --null-input --rawfile cars "${CARS_FILE}" '{"Args":["ImportCars", $cars]}')
+# the ctor is written to a file on the pod through a quoted heredoc and read
+# back in double quotes, so the shell there never interprets quotes, $ or \ in it
+cat <<EOF
+CTOR_FILE=\$(mktemp)
+cat > \${CTOR_FILE} <<'CTOR_EOF'
+${CTOR}
+CTOR_EOF
+echo "Submitting invoketransaction to smart contract on ${CHANNEL_ID}"
+peer chaincode invoke \
+  --channelID ${CHANNEL_ID} \
+  --name ${CCNAME} \
+  --ctor "\$(cat \${CTOR_FILE})" \
   --waitForEvent \
   --waitForEventTimeout 300s \
   --cafile \$ORDERER_TLS_ROOTCERT_FILE \
@@ -170,6 +214,7 @@ peer chaincode invoke \
   --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org1-cert.pem \
   --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org2-cert.pem \
   --tlsRootCertFiles /etc/hyperledger/fabric-peer/client-root-tlscas/tlsca.org3-cert.pem 
+rm -f \${CTOR_FILE}
 EOF
 }
 